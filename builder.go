@@ -0,0 +1,135 @@
+package tree
+
+import (
+	"errors"
+	"io"
+	"slices"
+)
+
+// Builder writes a tree to an io.Writer from a series of paths given in
+// lexical order, writing each Node as soon as all of its children have been
+// written.
+//
+// Only the Nodes along the current path are held in memory, and the output is
+// identical to that of calling SerialiseWithOptions on the equivalent tree.
+type Builder struct {
+	w       *writer
+	stack   []*buildNode
+	path    []string
+	last    []string
+	started bool
+}
+
+type buildNode struct {
+	children children
+	data     io.Reader
+}
+
+// NewBuilder creates a new Builder that will write to the given writer, using
+// the format extensions enabled in the given Options.
+//
+// As the Nodes given to Put have no Metadata, the Metadata option has no
+// effect.
+//
+// As with Serialise, if the given writer implements io.Seeker, it will be used
+// to determine the offset of the pointers in the tree.
+func NewBuilder(w io.Writer, opts Options) (*Builder, error) {
+	sw, err := newWriter(w, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Builder{w: sw, stack: []*buildNode{{}}}, nil
+}
+
+// Put adds a Node at the given path, with the data read from the given
+// io.Reader, which may be nil for a Node without data.
+//
+// Paths must be given in lexical order, comparing each name in turn, and each
+// path may only be given once; any missing Nodes along the path will be created
+// as empty Nodes. As such, the data for a Node must be given before the data
+// for any of its children. A path given out of order will result in
+// ErrUnsortedPath being returned.
+//
+// The data will not be read until all of the children of the Node have been
+// written, which will be on a call to Put with a path that is not a child of
+// the Node, or on calling Close.
+func (b *Builder) Put(path []string, data io.Reader) error {
+	if b.w.Err != nil {
+		return b.w.Err
+	}
+
+	if b.started && slices.Compare(path, b.last) <= 0 {
+		return ErrUnsortedPath
+	}
+
+	b.started = true
+	b.last = slices.Clone(path)
+
+	var common int
+
+	for common < len(b.path) && common < len(path) && b.path[common] == path[common] {
+		common++
+	}
+
+	for len(b.path) > common {
+		b.closeNode()
+	}
+
+	for _, name := range path[common:] {
+		b.stack = append(b.stack, &buildNode{})
+		b.path = append(b.path, name)
+	}
+
+	b.stack[len(b.stack)-1].data = data
+
+	return b.w.Err
+}
+
+func (b *Builder) closeNode() {
+	last := len(b.stack) - 1
+	node := b.stack[last]
+	name := b.path[last-1]
+	b.stack = b.stack[:last]
+	b.path = b.path[:last-1]
+
+	if b.w.Err != nil {
+		return
+	}
+
+	ptr, hash := writeRecord(b.w, node.children, readerData{node.data}, nil)
+	parent := b.stack[last-1]
+	parent.children = append(parent.children, child{name: name, pos: ptr, hash: hash})
+}
+
+// Close writes all remaining Nodes, including the root Node.
+//
+// It does not close the underlying writer, and the Builder should not be used
+// after it has been closed.
+func (b *Builder) Close() error {
+	for len(b.path) > 0 {
+		b.closeNode()
+	}
+
+	if b.w.Err == nil {
+		writeRecord(b.w, b.stack[0].children, readerData{b.stack[0].data}, nil)
+	}
+
+	return b.w.Err
+}
+
+type readerData struct {
+	io.Reader
+}
+
+func (r readerData) WriteTo(w io.Writer) (int64, error) {
+	if r.Reader == nil {
+		return 0, nil
+	}
+
+	return io.Copy(w, r.Reader)
+}
+
+// ErrUnsortedPath is returned from Builder.Put when a path is not given in
+// lexical order.
+var ErrUnsortedPath = errors.New("path not in lexical order")
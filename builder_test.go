@@ -0,0 +1,102 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	tree := genLargeTree(4)
+	text := node{name: "~text", data: []byte(strings.Repeat("compressible text ", 64))}
+
+	for n := range 10 {
+		text.children = append(text.children, node{
+			name: "shared/prefix/child-" + strconv.Itoa(n),
+			data: []byte(strings.Repeat(strconv.Itoa(n), 128)),
+		})
+	}
+
+	tree.children = append(tree.children, text)
+
+	for n, opts := range [...]Options{
+		{},
+		{Checksums: true},
+		{Hash: sha256.New},
+		{Dedup: true},
+		{Compression: CodecFlate},
+		{PrefixNames: 4},
+		{HashIndexThreshold: 2},
+		{Compression: CodecGzip, PrefixNames: 2, HashIndexThreshold: 1, Checksums: true, Hash: sha256.New},
+	} {
+		var expected, buf bytes.Buffer
+
+		SerialiseWithOptions(&expected, &tree, opts)
+
+		b, err := NewBuilder(&buf, opts)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if err := b.Put(nil, bytes.NewReader(tree.data)); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		for path, nd := range Flatten(&tree) {
+			var r io.Reader
+
+			if data := nd.(*node).data; data != nil {
+				r = bytes.NewReader(data)
+			}
+
+			if err := b.Put(path, r); err != nil {
+				t.Fatalf("test %d: unexpected error: %s", n+1, err)
+			}
+		}
+
+		if err := b.Close(); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+			t.Errorf("test %d: output did not match Serialise", n+1)
+		}
+
+		if read := readTree(OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))); !reflect.DeepEqual(read, tree) {
+			t.Errorf("test %d: Tree: did not read what we wrote", n+1)
+		}
+
+		if m, err := OpenMem(buf.Bytes()); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if read := readTree(m); !reflect.DeepEqual(read, tree) {
+			t.Errorf("test %d: MemTree: did not read what we wrote", n+1)
+		}
+	}
+}
+
+func TestBuilderOrder(t *testing.T) {
+	var buf bytes.Buffer
+
+	b, _ := NewBuilder(&buf, Options{})
+
+	for n, test := range [...]struct {
+		path []string
+		err  error
+	}{
+		{[]string{"A", "B"}, nil},
+		{[]string{"A"}, ErrUnsortedPath},
+		{[]string{"A", "B"}, ErrUnsortedPath},
+		{[]string{"A", "B", "C"}, nil},
+		{[]string{"A", "C"}, nil},
+		{[]string{"A", "B", "D"}, ErrUnsortedPath},
+		{[]string{"B"}, nil},
+		{nil, ErrUnsortedPath},
+	} {
+		if err := b.Put(test.path, nil); !errors.Is(err, test.err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.err, err)
+		}
+	}
+}
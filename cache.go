@@ -0,0 +1,184 @@
+package tree
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"sync"
+)
+
+const (
+	defaultPageSize  = 4096
+	defaultCacheSize = 256
+)
+
+// CachedReaderAt is an io.ReaderAt that caches the data read from an
+// underlying io.ReaderAt in fixed-size pages, discarding the least recently
+// used pages once the capacity has been reached.
+//
+// It is intended to wrap slow io.ReaderAt implementations, such as those that
+// perform network requests, before being passed to OpenAt.
+//
+// Concurrent reads of the same page share a single read of the underlying
+// io.ReaderAt. A page cut short by the end of the data is read again when a
+// later read needs bytes beyond it, so data appended to the underlying
+// io.ReaderAt will be seen.
+//
+// It is safe for concurrent use, so long as the underlying io.ReaderAt is.
+type CachedReaderAt struct {
+	r        io.ReaderAt
+	pageSize int64
+	capacity int
+
+	mu    sync.Mutex
+	pages map[int64]*list.Element
+	lru   list.List
+	stats CacheStats
+}
+
+type cachePage struct {
+	index int64
+	data  []byte
+	err   error
+	done  chan struct{}
+}
+
+// short reports whether a page that has finished loading holds fewer than
+// need bytes.
+func (p *cachePage) short(need int64) bool {
+	select {
+	case <-p.done:
+		return int64(len(p.data)) < need
+	default:
+		return false
+	}
+}
+
+// CacheStats contains the hit and miss counts of a CachedReaderAt.
+//
+// Each page touched by a read counts as a single hit or miss.
+type CacheStats struct {
+	Hits, Misses uint64
+}
+
+// NewCachedReaderAt creates a new CachedReaderAt which will read from the
+// given io.ReaderAt in pages of pageSize bytes, holding up to capacity pages.
+//
+// A pageSize or capacity of zero or less will be replaced by a default of 4096
+// bytes or 256 pages respectively.
+func NewCachedReaderAt(r io.ReaderAt, pageSize, capacity int) *CachedReaderAt {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	if capacity <= 0 {
+		capacity = defaultCacheSize
+	}
+
+	return &CachedReaderAt{
+		r:        r,
+		pageSize: int64(pageSize),
+		capacity: capacity,
+		pages:    make(map[int64]*list.Element),
+	}
+}
+
+// ReadAt implements the io.ReaderAt interface, reading the data from the
+// cache, filling the cache from the underlying io.ReaderAt as needed.
+func (c *CachedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+
+	var n int
+
+	for n < len(p) {
+		start := off % c.pageSize
+
+		page, err := c.getPage(off/c.pageSize, min(start+int64(len(p)-n), c.pageSize))
+		if err != nil {
+			return n, err
+		}
+
+		if start >= int64(len(page)) {
+			return n, io.EOF
+		}
+
+		m := copy(p[n:], page[start:])
+		n += m
+		off += int64(m)
+
+		if int64(len(page)) < c.pageSize && n < len(p) {
+			return n, io.EOF
+		}
+	}
+
+	return n, nil
+}
+
+func (c *CachedReaderAt) getPage(index, need int64) ([]byte, error) {
+	c.mu.Lock()
+
+	if e, ok := c.pages[index]; ok {
+		page := e.Value.(*cachePage)
+
+		if !page.short(need) {
+			c.lru.MoveToFront(e)
+			c.stats.Hits++
+			c.mu.Unlock()
+
+			<-page.done
+
+			return page.data, page.err
+		}
+
+		c.remove(e)
+	}
+
+	c.stats.Misses++
+
+	page := &cachePage{index: index, done: make(chan struct{})}
+	c.pages[index] = c.lru.PushFront(page)
+
+	for c.lru.Len() > c.capacity {
+		c.remove(c.lru.Back())
+	}
+
+	c.mu.Unlock()
+
+	data := make([]byte, c.pageSize)
+
+	n, err := c.r.ReadAt(data, index*c.pageSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		page.err = err
+
+		c.mu.Lock()
+
+		if e, ok := c.pages[index]; ok && e.Value == page {
+			c.remove(e)
+		}
+
+		c.mu.Unlock()
+	} else {
+		page.data = data[:n]
+	}
+
+	close(page.done)
+
+	return page.data, page.err
+}
+
+func (c *CachedReaderAt) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.pages, e.Value.(*cachePage).index)
+}
+
+// Stats returns the current hit and miss counts of the cache.
+func (c *CachedReaderAt) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+var errNegativeOffset = errors.New("negative offset")
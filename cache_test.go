@@ -0,0 +1,244 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestCachedReaderAt(t *testing.T) {
+	data := make([]byte, 1000)
+
+	rand.Read(data)
+
+	r := &countingReaderAt{ReaderAt: bytes.NewReader(data)}
+	c := NewCachedReaderAt(r, 64, 4)
+
+	for n, test := range [...]struct {
+		Offset, Length int
+		Read           int
+		Error          error
+		Stats          CacheStats
+	}{
+		{ // 1
+			Offset: 0, Length: 10,
+			Read:  10,
+			Stats: CacheStats{Misses: 1},
+		},
+		{ // 2
+			Offset: 10, Length: 54,
+			Read:  54,
+			Stats: CacheStats{Hits: 1, Misses: 1},
+		},
+		{ // 3
+			Offset: 60, Length: 10,
+			Read:  10,
+			Stats: CacheStats{Hits: 2, Misses: 2},
+		},
+		{ // 4
+			Offset: 128, Length: 192,
+			Read:  192,
+			Stats: CacheStats{Hits: 2, Misses: 5},
+		},
+		{ // 5
+			Offset: 0, Length: 1,
+			Read:  1,
+			Stats: CacheStats{Hits: 2, Misses: 6},
+		},
+		{ // 6
+			Offset: 990, Length: 20,
+			Read:  10,
+			Error: io.EOF,
+			Stats: CacheStats{Hits: 2, Misses: 7},
+		},
+		{ // 7
+			Offset: 1000, Length: 1,
+			Error: io.EOF,
+			Stats: CacheStats{Hits: 2, Misses: 8},
+		},
+		{ // 8
+			Offset: 1024, Length: 1,
+			Error: io.EOF,
+			Stats: CacheStats{Hits: 2, Misses: 9},
+		},
+		{ // 9
+			Offset: 990, Length: 10,
+			Read:  10,
+			Stats: CacheStats{Hits: 3, Misses: 9},
+		},
+	} {
+		buf := make([]byte, test.Length)
+
+		read, err := c.ReadAt(buf, int64(test.Offset))
+		if !errors.Is(err, test.Error) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Error, err)
+		} else if read != test.Read {
+			t.Errorf("test %d: expecting to read %d bytes, read %d", n+1, test.Read, read)
+		} else if !bytes.Equal(buf[:read], data[min(test.Offset, len(data)):][:read]) {
+			t.Errorf("test %d: read incorrect data", n+1)
+		} else if stats := c.Stats(); stats != test.Stats {
+			t.Errorf("test %d: expecting stats %v, got %v", n+1, test.Stats, stats)
+		}
+	}
+
+	if _, err := c.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Errorf("expecting error for negative offset")
+	}
+}
+
+func TestCachedReaderAtGrowing(t *testing.T) {
+	r := &growingReaderAt{data: []byte("123")}
+	c := NewCachedReaderAt(r, 8, 4)
+	buf := make([]byte, 6)
+
+	if n, err := c.ReadAt(buf, 0); !errors.Is(err, io.EOF) {
+		t.Errorf("expecting EOF, got %v", err)
+	} else if n != 3 {
+		t.Errorf("expecting to read 3 bytes, read %d", n)
+	}
+
+	r.mu.Lock()
+	r.data = append(r.data, "4567890"...)
+	r.mu.Unlock()
+
+	if n, err := c.ReadAt(buf, 0); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if string(buf[:n]) != "123456" {
+		t.Errorf("expecting to read %q, read %q", "123456", buf[:n])
+	}
+
+	if n, err := c.ReadAt(buf, 4); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if string(buf[:n]) != "567890" {
+		t.Errorf("expecting to read %q, read %q", "567890", buf[:n])
+	}
+
+	if stats := c.Stats(); stats != (CacheStats{Hits: 1, Misses: 3}) {
+		t.Errorf("expecting stats %v, got %v", CacheStats{Hits: 1, Misses: 3}, stats)
+	}
+}
+
+func TestCachedReaderAtShared(t *testing.T) {
+	const readers = 8
+
+	r := &blockingReaderAt{
+		ReaderAt: bytes.NewReader(make([]byte, 100)),
+		started:  make(chan struct{}, readers),
+		release:  make(chan struct{}),
+	}
+	c := NewCachedReaderAt(r, 64, 4)
+
+	var wg sync.WaitGroup
+
+	for range readers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, err := c.ReadAt(make([]byte, 10), 0); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}()
+	}
+
+	<-r.started
+
+	for c.Stats().Hits < readers-1 {
+		runtime.Gosched()
+	}
+
+	close(r.release)
+	wg.Wait()
+
+	if reads := len(r.started); reads != 0 {
+		t.Errorf("expecting a single read of the underlying reader, got %d", reads+1)
+	}
+
+	r.ReaderAt = errReaderAt{}
+	r.release = nil
+
+	c = NewCachedReaderAt(r, 64, 4)
+
+	for range 2 {
+		if _, err := c.ReadAt(make([]byte, 10), 0); !errors.Is(err, errTestRead) {
+			t.Errorf("expecting errTestRead, got %v", err)
+		}
+	}
+
+	if stats := c.Stats(); stats != (CacheStats{Misses: 2}) {
+		t.Errorf("expecting failed reads not to be cached, got stats %v", stats)
+	}
+}
+
+type growingReaderAt struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (g *growingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return bytes.NewReader(g.data).ReadAt(p, off)
+}
+
+type blockingReaderAt struct {
+	io.ReaderAt
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if b.release != nil {
+		b.started <- struct{}{}
+		<-b.release
+	}
+
+	return b.ReaderAt.ReadAt(p, off)
+}
+
+type errReaderAt struct{}
+
+func (errReaderAt) ReadAt([]byte, int64) (int, error) {
+	return 0, errTestRead
+}
+
+var errTestRead = errors.New("test read error")
+
+func TestCachedReaderAtTree(t *testing.T) {
+	tree := genLargeTree(3)
+
+	var buf bytes.Buffer
+
+	if err := Serialise(&buf, &tree); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c := NewCachedReaderAt(bytes.NewReader(buf.Bytes()), 0, 0)
+
+	var wg sync.WaitGroup
+
+	for range 4 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if read := readTree(OpenAt(c, int64(buf.Len()))); !reflect.DeepEqual(read, tree) {
+				t.Errorf("did not read what we wrote")
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if stats := c.Stats(); stats.Hits == 0 || stats.Misses == 0 {
+		t.Errorf("expecting both hits and misses, got %v", stats)
+	}
+}
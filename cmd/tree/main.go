@@ -0,0 +1,372 @@
+// Tree is a tool for inspecting, creating, and extracting tree files.
+//
+// Usage:
+//
+//	tree ls [-l] FILE [PATH]
+//	tree cat FILE PATH
+//	tree stat FILE [PATH]
+//	tree find [-name GLOB] [-type d|f] [-minsize N] [-maxsize N] [-mindepth N] [-maxdepth N] FILE [PATH]
+//	tree pack [-compress none|flate|zlib|gzip] [-dedup] [-checksums] [-index N] [-prefix N] [-mixed dir|sidecar] [-sidecar SUFFIX] DIR FILE
+//	tree unpack [-mixed dir|sidecar|error] [-sidecar SUFFIX] [-overwrite none|replace|skip] FILE DIR
+//	tree dump FILE
+//	tree verify FILE
+//
+// Paths are made up of '/' separated names, and an empty path refers to the
+// root of the tree.
+//
+// Files written by unpack with -mixed sidecar can be stored back as the data
+// of their directories by pack with the same -mixed and -sidecar flags.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"vimagination.zapto.org/tree"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(os.Stderr, usage)
+		}
+
+		os.Exit(1)
+	}
+}
+
+const usage = `Usage:
+  tree ls [-l] FILE [PATH]
+  tree cat FILE PATH
+  tree stat FILE [PATH]
+  tree find [-name GLOB] [-type d|f] [-minsize N] [-maxsize N] [-mindepth N] [-maxdepth N] FILE [PATH]
+  tree pack [-compress none|flate|zlib|gzip] [-dedup] [-checksums] [-index N] [-prefix N] [-mixed dir|sidecar] [-sidecar SUFFIX] DIR FILE
+  tree unpack [-mixed dir|sidecar|error] [-sidecar SUFFIX] [-overwrite none|replace|skip] FILE DIR
+  tree dump FILE
+  tree verify FILE
+`
+
+func run(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	cmd, args := args[0], args[1:]
+
+	switch cmd {
+	case "ls":
+		return ls(args, w)
+	case "cat":
+		return cat(args, w)
+	case "stat":
+		return stat(args, w)
+	case "find":
+		return find(args, w)
+	case "pack":
+		return pack(args)
+	case "unpack":
+		return unpack(args)
+	case "dump":
+		return dump(args, w)
+	case "verify":
+		return verify(args, w)
+	}
+
+	return fmt.Errorf("%w: unknown command %q", errUsage, cmd)
+}
+
+func open(fs *flag.FlagSet, args []string, pathRequired bool) (*tree.Tree, io.Closer, error) {
+	fs.SetOutput(io.Discard)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errUsage, err)
+	}
+
+	if fs.NArg() < 1 || fs.NArg() > 2 || pathRequired && fs.NArg() != 2 {
+		return nil, nil, fmt.Errorf("%w: invalid number of arguments", errUsage)
+	}
+
+	f, err := tree.OpenFile(fs.Arg(0))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	node, err := f.Navigate(splitPath(fs.Arg(1)))
+	if err != nil {
+		f.Close()
+
+		return nil, nil, err
+	}
+
+	return node, f, nil
+}
+
+func splitPath(p string) iter.Seq[string] {
+	p = strings.Trim(p, "/")
+
+	if p == "" {
+		return slices.Values([]string(nil))
+	}
+
+	return strings.SplitSeq(p, "/")
+}
+
+func ls(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	long := fs.Bool("l", false, "long listing format")
+
+	node, f, err := open(fs, args, false)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', tabwriter.AlignRight)
+
+	for name, child := range node.Children() {
+		if ce, ok := child.(tree.ChildrenError); ok {
+			return ce
+		}
+
+		if !*long {
+			fmt.Fprintln(w, name)
+
+			continue
+		}
+
+		c := child.(*tree.Tree)
+
+		dataLen, err := c.DataLen()
+		if err != nil {
+			return err
+		}
+
+		numChildren, err := c.NumChildren()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(tw, "%d\t%d\t %s\n", dataLen, numChildren, name)
+	}
+
+	return tw.Flush()
+}
+
+func cat(args []string, w io.Writer) error {
+	node, f, err := open(flag.NewFlagSet("cat", flag.ContinueOnError), args, true)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	_, err = node.WriteTo(w)
+
+	return err
+}
+
+func stat(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("stat", flag.ContinueOnError)
+
+	node, f, err := open(fs, args, false)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	dataLen, err := node.DataLen()
+	if err != nil {
+		return err
+	}
+
+	numChildren, err := node.NumChildren()
+	if err != nil {
+		return err
+	}
+
+	hash, err := node.Hash()
+	if err != nil {
+		return err
+	}
+
+	meta, err := node.Metadata()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Path: /%s\n", strings.Trim(fs.Arg(1), "/"))
+	fmt.Fprintf(w, "Data: %d bytes\n", dataLen)
+	fmt.Fprintf(w, "Children: %d\n", numChildren)
+
+	if hash != nil {
+		fmt.Fprintf(w, "Hash: %s\n", hex.EncodeToString(hash))
+	}
+
+	if meta != nil {
+		fmt.Fprintf(w, "Mode: %s\n", meta.Mode)
+
+		if !meta.ModTime.IsZero() {
+			fmt.Fprintf(w, "Modified: %s\n", meta.ModTime)
+		}
+	}
+
+	return nil
+}
+
+func find(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("find", flag.ContinueOnError)
+	name := fs.String("name", "", "glob pattern to match against node names")
+	typ := fs.String("type", "", "d for nodes with children, f for nodes without")
+	minSize := fs.Int64("minsize", -1, "minimum data size, in bytes")
+	maxSize := fs.Int64("maxsize", -1, "maximum data size, in bytes")
+	minDepth := fs.Int("mindepth", 0, "minimum depth")
+	maxDepth := fs.Int("maxdepth", -1, "maximum depth")
+
+	node, f, err := open(fs, args, false)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	if *typ != "" && *typ != "d" && *typ != "f" {
+		return fmt.Errorf("%w: invalid type %q", errUsage, *typ)
+	}
+
+	if _, err := path.Match(*name, ""); err != nil {
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+
+	var ferr error
+
+	for p := range tree.Filter(node, func(p []string, n tree.Node) int {
+		if ferr != nil || *maxDepth >= 0 && len(p) > *maxDepth {
+			return -1
+		}
+
+		if ce, ok := n.(tree.ChildrenError); ok {
+			ferr = ce
+
+			return -1
+		}
+
+		if len(p) < *minDepth {
+			return 0
+		}
+
+		if *name != "" {
+			if matched, _ := path.Match(*name, p[len(p)-1]); !matched {
+				return 0
+			}
+		}
+
+		t := n.(*tree.Tree)
+
+		if *typ != "" {
+			numChildren, err := t.NumChildren()
+			if err != nil {
+				ferr = err
+
+				return -1
+			}
+
+			if (numChildren > 0) != (*typ == "d") {
+				return 0
+			}
+		}
+
+		if *minSize >= 0 || *maxSize >= 0 {
+			size, err := t.DataLen()
+			if err != nil {
+				ferr = err
+
+				return -1
+			}
+
+			if *minSize >= 0 && size < *minSize || *maxSize >= 0 && size > *maxSize {
+				return 0
+			}
+		}
+
+		return 1
+	}) {
+		fmt.Fprintln(w, strings.Join(p, "/"))
+	}
+
+	return ferr
+}
+
+func dump(args []string, w io.Writer) error {
+	f, size, err := openRaw(flag.NewFlagSet("dump", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return tree.Dump(w, f, size)
+}
+
+func verify(args []string, w io.Writer) error {
+	f, size, err := openRaw(flag.NewFlagSet("verify", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var errs tree.VerifyErrors
+
+	if err := tree.Verify(f, size); errors.As(err, &errs) {
+		for _, err := range errs {
+			fmt.Fprintln(w, err)
+		}
+
+		return fmt.Errorf("found %d problems", len(errs))
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func openRaw(fs *flag.FlagSet, args []string) (*os.File, int64, error) {
+	fs.SetOutput(io.Discard)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", errUsage, err)
+	}
+
+	if fs.NArg() != 1 {
+		return nil, 0, fmt.Errorf("%w: invalid number of arguments", errUsage)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+
+		return nil, 0, err
+	}
+
+	return f, size, nil
+}
+
+var errUsage = errors.New("invalid usage")
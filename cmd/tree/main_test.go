@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vimagination.zapto.org/tree"
+)
+
+func TestRun(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.tree")
+
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := tree.SerialiseWithOptions(f, tree.Branch{
+		{Name: "a", Node: tree.Branch{
+			{Name: "b.txt", Node: tree.Leaf("Hello, World")},
+			{Name: "c", Node: tree.Branch{
+				{Name: "d.txt", Node: tree.Leaf("123")},
+			}},
+		}},
+		{Name: "e.json", Node: tree.Leaf("{}")},
+	}, tree.Options{Hash: sha256.New}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f.Close()
+
+	hash, err := tree.Hash(tree.Leaf("123"), sha256.New)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for n, test := range [...]struct {
+		Args   []string
+		Output string
+		Error  error
+	}{
+		{ // 1
+			Error: errUsage,
+		},
+		{ // 2
+			Args:  []string{"unknown"},
+			Error: errUsage,
+		},
+		{ // 3
+			Args:   []string{"ls", file},
+			Output: "a\ne.json\n",
+		},
+		{ // 4
+			Args:   []string{"ls", "-l", file, "a"},
+			Output: " 12 0 b.txt\n  0 1 c\n",
+		},
+		{ // 5
+			Args:   []string{"cat", file, "a/b.txt"},
+			Output: "Hello, World",
+		},
+		{ // 6
+			Args:  []string{"cat", file},
+			Error: errUsage,
+		},
+		{ // 7
+			Args:  []string{"cat", file, "a/missing"},
+			Error: tree.ChildNotFoundError("missing"),
+		},
+		{ // 8
+			Args:   []string{"stat", file, "/a/c/d.txt"},
+			Output: "Path: /a/c/d.txt\nData: 3 bytes\nChildren: 0\nHash: " + hex.EncodeToString(hash) + "\n",
+		},
+		{ // 9
+			Args:   []string{"find", file},
+			Output: "a\na/b.txt\na/c\na/c/d.txt\ne.json\n",
+		},
+		{ // 10
+			Args:   []string{"find", "-name", "*.txt", file},
+			Output: "a/b.txt\na/c/d.txt\n",
+		},
+		{ // 11
+			Args:   []string{"find", "-type", "d", file},
+			Output: "a\na/c\n",
+		},
+		{ // 12
+			Args:   []string{"find", "-minsize", "3", "-maxsize", "5", file},
+			Output: "a/c/d.txt\n",
+		},
+		{ // 13
+			Args:   []string{"find", "-mindepth", "2", "-maxdepth", "2", file},
+			Output: "a/b.txt\na/c\n",
+		},
+		{ // 14
+			Args:   []string{"find", file, "a/c"},
+			Output: "d.txt\n",
+		},
+		{ // 15
+			Args:  []string{"find", "-type", "x", file},
+			Error: errUsage,
+		},
+		{ // 16
+			Args:  []string{"dump"},
+			Error: errUsage,
+		},
+		{ // 17
+			Args:  []string{"dump", file, "a"},
+			Error: errUsage,
+		},
+		{ // 18
+			Args: []string{"verify", file},
+		},
+		{ // 19
+			Args:  []string{"verify"},
+			Error: errUsage,
+		},
+	} {
+		var buf bytes.Buffer
+
+		if err := run(test.Args, &buf); !errors.Is(err, test.Error) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Error, err)
+		} else if out := buf.String(); out != test.Output {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, out)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.tree")
+
+	var buf bytes.Buffer
+
+	if err := tree.Serialise(&buf, tree.Branch{{Name: "a", Node: tree.Leaf("b")}}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var expected, out bytes.Buffer
+
+	if err := tree.Dump(&expected, bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := run([]string{"dump", file}, &out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if out.String() != expected.String() {
+		t.Errorf("expecting output %q, got %q", expected.String(), out.String())
+	}
+}
+
+func TestVerify(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.tree")
+
+	if err := os.WriteFile(file, []byte{'B', 'A', 0x00, 0x00, 0x08, 0x08, 0x02, 0x41}, 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var out bytes.Buffer
+
+	if err := run([]string{"verify", file}, &out); err == nil {
+		t.Errorf("expecting error, got nil")
+	} else if expected := "offset 1: child names not sorted\n"; out.String() != expected {
+		t.Errorf("expecting output %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"vimagination.zapto.org/tree"
+)
+
+var (
+	codecs = map[string]uint8{
+		"none":  0,
+		"flate": tree.CodecFlate,
+		"zlib":  tree.CodecZlib,
+		"gzip":  tree.CodecGzip,
+	}
+	mixedNodes = map[string]tree.MixedNode{
+		"dir":     tree.MixedDirectory,
+		"sidecar": tree.MixedSidecar,
+		"error":   tree.MixedError,
+	}
+	packMixedNodes = map[string]tree.MixedNode{
+		"dir":     tree.MixedDirectory,
+		"sidecar": tree.MixedSidecar,
+	}
+	overwrites = map[string]tree.Overwrite{
+		"none":    tree.OverwriteNone,
+		"replace": tree.OverwriteReplace,
+		"skip":    tree.OverwriteSkip,
+	}
+)
+
+func parseArgs(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(io.Discard)
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+
+	if fs.NArg() != 2 {
+		return fmt.Errorf("%w: invalid number of arguments", errUsage)
+	}
+
+	return nil
+}
+
+func lookup[T any](m map[string]T, name, value string) (T, error) {
+	v, ok := m[value]
+	if !ok {
+		return v, fmt.Errorf("%w: invalid %s %q", errUsage, name, value)
+	}
+
+	return v, nil
+}
+
+func pack(args []string) error {
+	fs := flag.NewFlagSet("pack", flag.ContinueOnError)
+	compress := fs.String("compress", "none", "compression codec: none, flate, zlib, or gzip")
+	dedup := fs.Bool("dedup", false, "store identical nodes only once")
+	checksums := fs.Bool("checksums", false, "store a checksum with each node")
+	index := fs.Int("index", 0, "store a hash index of child names for nodes with at least this many children")
+	prefix := fs.Int("prefix", 0, "prefix compress child names, storing every Nth name in full")
+	mixed := fs.String("mixed", "dir", "handling of sidecar files: dir, or sidecar to store them as the data of their directory")
+	sidecar := fs.String("sidecar", "", "suffix for sidecar files (default \".data\")")
+
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	codec, err := lookup(codecs, "compress", *compress)
+	if err != nil {
+		return err
+	}
+
+	mode, err := lookup(packMixedNodes, "mixed", *mixed)
+	if err != nil {
+		return err
+	}
+
+	if *sidecar == "" {
+		*sidecar = ".data"
+	}
+
+	dir, output := fs.Arg(0), fs.Arg(1)
+
+	if err := checkOutput(dir, output); err != nil {
+		return err
+	}
+
+	root := tree.FromFS(os.DirFS(dir), ".")
+
+	if mode == tree.MixedSidecar {
+		root, err = sidecarRoot(dir, *sidecar)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	if err = tree.SerialiseWithOptions(f, root, tree.Options{
+		Compression:        codec,
+		Dedup:              *dedup,
+		Checksums:          *checksums,
+		HashIndexThreshold: *index,
+		PrefixNames:        *prefix,
+	}); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+
+	if err != nil {
+		os.Remove(output)
+	}
+
+	return err
+}
+
+// checkOutput returns an error if the output file would be created inside the
+// directory being packed, where it would be read while being written.
+func checkOutput(dir, output string) error {
+	absDir, err := realPath(dir)
+	if err != nil {
+		return err
+	}
+
+	absOutput, err := realPath(filepath.Dir(output))
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(absDir, filepath.Join(absOutput, filepath.Base(output)))
+	if err != nil {
+		return err
+	}
+
+	if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%w: %s", errOutputInDir, output)
+	}
+
+	return nil
+}
+
+func realPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(abs)
+}
+
+// sidecarNode presents a directory as a Node, storing any sidecar file written
+// by unpack with -mixed sidecar as the data of the directory it belongs to,
+// instead of as a sibling.
+type sidecarNode struct {
+	fsys   fs.FS
+	path   string
+	data   tree.Node
+	suffix string
+}
+
+func sidecarRoot(dir, suffix string) (tree.Node, error) {
+	root := sidecarNode{fsys: os.DirFS(dir), path: ".", suffix: suffix}
+	data := filepath.Clean(dir) + suffix
+
+	if fi, err := os.Stat(data); err == nil && fi.Mode().IsRegular() {
+		root.data = tree.FromFS(os.DirFS(filepath.Dir(data)), filepath.Base(data))
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+func (s sidecarNode) Children() iter.Seq2[string, tree.Node] {
+	entries, err := fs.ReadDir(s.fsys, s.path)
+	if err != nil {
+		return func(yield func(string, tree.Node) bool) { yield("", tree.NewChildrenError(err)) }
+	}
+
+	dirs := make(map[string]bool)
+	files := make(map[string]bool)
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs[entry.Name()] = true
+		} else if entry.Type().IsRegular() {
+			files[entry.Name()] = true
+		}
+	}
+
+	return func(yield func(string, tree.Node) bool) {
+		for _, entry := range entries {
+			name := entry.Name()
+			p := path.Join(s.path, name)
+
+			var child tree.Node
+
+			if dirs[name] {
+				dir := sidecarNode{fsys: s.fsys, path: p, suffix: s.suffix}
+
+				if files[name+s.suffix] {
+					dir.data = tree.FromFS(s.fsys, p+s.suffix)
+				}
+
+				child = dir
+			} else if !files[name] || strings.HasSuffix(name, s.suffix) && dirs[strings.TrimSuffix(name, s.suffix)] {
+				continue
+			} else {
+				child = tree.FromFS(s.fsys, p)
+			}
+
+			if !yield(name, child) {
+				return
+			}
+		}
+	}
+}
+
+func (s sidecarNode) WriteTo(w io.Writer) (int64, error) {
+	if s.data == nil {
+		return 0, nil
+	}
+
+	return s.data.WriteTo(w)
+}
+
+func unpack(args []string) error {
+	fs := flag.NewFlagSet("unpack", flag.ContinueOnError)
+	mixed := fs.String("mixed", "dir", "handling of nodes with data and children: dir, sidecar, or error")
+	sidecar := fs.String("sidecar", "", "suffix for sidecar files (default \".data\")")
+	overwrite := fs.String("overwrite", "none", "handling of existing files: none, replace, or skip")
+
+	if err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	opts := tree.ExtractOptions{SidecarSuffix: *sidecar}
+
+	var err error
+
+	if opts.Mixed, err = lookup(mixedNodes, "mixed", *mixed); err != nil {
+		return err
+	}
+
+	if opts.Overwrite, err = lookup(overwrites, "overwrite", *overwrite); err != nil {
+		return err
+	}
+
+	f, err := tree.OpenFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return tree.Extract(f, fs.Arg(1), opts)
+}
+
+var errOutputInDir = errors.New("output file is inside the packed directory")
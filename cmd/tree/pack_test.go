@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"vimagination.zapto.org/tree"
+)
+
+func TestPackUnpack(t *testing.T) {
+	var (
+		tmp  = t.TempDir()
+		src  = filepath.Join(tmp, "src")
+		file = filepath.Join(tmp, "test.tree")
+		dst  = filepath.Join(tmp, "dst")
+	)
+
+	files := map[string]string{
+		"a.txt":         "Hello, World",
+		"dir/b.txt":     "Hello, World",
+		"dir/sub/c.txt": "123",
+	}
+
+	for name, data := range files {
+		path := filepath.Join(src, name)
+
+		os.MkdirAll(filepath.Dir(path), 0o755)
+
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	for n, test := range [...]struct {
+		Pack, Unpack []string
+		Error        error
+	}{
+		{ // 1
+			Pack:   []string{"pack", src, file},
+			Unpack: []string{"unpack", file, dst},
+		},
+		{ // 2
+			Pack:   []string{"pack", "-compress", "gzip", "-dedup", "-checksums", "-index", "1", "-prefix", "16", src, file},
+			Unpack: []string{"unpack", "-overwrite", "replace", file, dst},
+		},
+		{ // 3
+			Pack:   []string{"pack", src, file},
+			Unpack: []string{"unpack", file, dst},
+			Error:  fs.ErrExist,
+		},
+		{ // 4
+			Pack:   []string{"pack", src, file},
+			Unpack: []string{"unpack", "-overwrite", "skip", "-mixed", "sidecar", file, dst},
+		},
+		{ // 5
+			Pack:  []string{"pack", "-compress", "lzma", src, file},
+			Error: errUsage,
+		},
+		{ // 6
+			Pack:   []string{"pack", src, file},
+			Unpack: []string{"unpack", "-mixed", "other", file, dst},
+			Error:  errUsage,
+		},
+	} {
+		err := run(test.Pack, io.Discard)
+		if err == nil {
+			err = run(test.Unpack, io.Discard)
+		}
+
+		if !errors.Is(err, test.Error) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Error, err)
+		} else if err == nil {
+			if err := fstest.TestFS(os.DirFS(dst), "a.txt", "dir/b.txt", "dir/sub/c.txt"); err != nil {
+				t.Errorf("test %d: %s", n+1, err)
+			}
+
+			read := make(map[string]string)
+
+			for name := range files {
+				data, _ := os.ReadFile(filepath.Join(dst, name))
+				read[name] = string(data)
+			}
+
+			if !reflect.DeepEqual(read, files) {
+				t.Errorf("test %d: expecting files %v, got %v", n+1, files, read)
+			}
+		}
+	}
+}
+
+func TestPackSidecar(t *testing.T) {
+	var (
+		tmp      = t.TempDir()
+		original = filepath.Join(tmp, "original.tree")
+		dst      = filepath.Join(tmp, "dst")
+		packed   = filepath.Join(tmp, "packed.tree")
+		root     = tree.Branch{
+			{Name: "a", Node: mixedNode{Branch: tree.Branch{{Name: "b", Node: tree.Leaf("123")}}, data: "dir data"}},
+			{Name: "c.txt", Node: tree.Leaf("456")},
+		}
+	)
+
+	f, err := os.Create(original)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := tree.Serialise(f, mixedNode{Branch: root, data: "root data"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f.Close()
+
+	if err := run([]string{"unpack", "-mixed", "sidecar", "-sidecar", ".side", original, dst}, io.Discard); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for n, test := range [...]struct {
+		Args    []string
+		Changes int
+	}{
+		{ // 1
+			Args: []string{"pack", "-mixed", "sidecar", "-sidecar", ".side", dst, packed},
+		},
+		{ // 2
+			Args:    []string{"pack", dst, packed},
+			Changes: 3,
+		},
+	} {
+		if err := run(test.Args, io.Discard); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		a, err := tree.OpenFile(original)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		b, err := tree.OpenFile(packed)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		var changes int
+
+		for range tree.Diff(a, b) {
+			changes++
+		}
+
+		if changes != test.Changes {
+			t.Errorf("test %d: expecting %d changes, got %d", n+1, test.Changes, changes)
+		}
+
+		a.Close()
+		b.Close()
+	}
+}
+
+func TestPackOutputInDir(t *testing.T) {
+	dir := t.TempDir()
+
+	for n, output := range [...]string{
+		filepath.Join(dir, "out.tree"),
+		filepath.Join(dir, ".", "sub", "..", "out.tree"),
+	} {
+		os.MkdirAll(filepath.Join(dir, "sub"), 0o755)
+
+		if err := run([]string{"pack", dir, output}, io.Discard); !errors.Is(err, errOutputInDir) {
+			t.Errorf("test %d: expecting errOutputInDir, got %v", n+1, err)
+		}
+
+		if _, err := os.Stat(output); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("test %d: expecting output not to be created, got %v", n+1, err)
+		}
+	}
+}
+
+type mixedNode struct {
+	tree.Branch
+	data string
+}
+
+func (m mixedNode) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, m.data)
+
+	return int64(n), err
+}
@@ -0,0 +1,149 @@
+package tree
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Codec compresses and decompresses the data stored on Nodes.
+type Codec interface {
+	// NewWriter returns a WriteCloser that writes compressed data to the
+	// given Writer; all data must be written upon a call to Close.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+
+	// NewReader returns a ReadCloser that decompresses the data read from
+	// the given Reader.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// The IDs of the built-in Codecs.
+const (
+	CodecFlate uint8 = iota + 1
+	CodecZlib
+	CodecGzip
+)
+
+type codecFuncs struct {
+	newWriter func(io.Writer) (io.WriteCloser, error)
+	newReader func(io.Reader) (io.ReadCloser, error)
+}
+
+func (c codecFuncs) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return c.newWriter(w)
+}
+
+func (c codecFuncs) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return c.newReader(r)
+}
+
+var codecs = struct {
+	sync.RWMutex
+	codecs map[uint8]Codec
+}{
+	codecs: map[uint8]Codec{
+		CodecFlate: codecFuncs{
+			newWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return flate.NewWriter(w, flate.BestCompression)
+			},
+			newReader: func(r io.Reader) (io.ReadCloser, error) {
+				return flate.NewReader(r), nil
+			},
+		},
+		CodecZlib: codecFuncs{
+			newWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return zlib.NewWriterLevel(w, zlib.BestCompression)
+			},
+			newReader: zlib.NewReader,
+		},
+		CodecGzip: codecFuncs{
+			newWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return gzip.NewWriterLevel(w, gzip.BestCompression)
+			},
+			newReader: func(r io.Reader) (io.ReadCloser, error) {
+				return gzip.NewReader(r)
+			},
+		},
+	},
+}
+
+// RegisterCodec registers a Codec with the given ID, replacing any existing
+// Codec with the same ID.
+//
+// The ID is stored with any Node compressed with the Codec, so the same Codec
+// must be registered with the same ID when reading the tree.
+//
+// The ID 0 is reserved, and will cause this function to panic.
+func RegisterCodec(id uint8, codec Codec) {
+	if id == 0 {
+		panic("tree: cannot register codec with ID 0")
+	}
+
+	codecs.Lock()
+	codecs.codecs[id] = codec
+	codecs.Unlock()
+}
+
+func getCodec(id uint8) (Codec, error) {
+	codecs.RLock()
+	codec, ok := codecs.codecs[id]
+	codecs.RUnlock()
+
+	if !ok {
+		return nil, UnknownCodecError(id)
+	}
+
+	return codec, nil
+}
+
+// decompress returns a ReadCloser that decompresses the data read from r with
+// the given Codec, returning ErrSizeMismatch should the decompressed data not be
+// exactly size bytes long.
+func decompress(codec Codec, r io.Reader, size int64) (io.ReadCloser, error) {
+	rc, err := codec.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sizedReader{ReadCloser: rc, remaining: size}, nil
+}
+
+type sizedReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (s *sizedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > s.remaining {
+		p = p[:s.remaining+1]
+	}
+
+	n, err := s.ReadCloser.Read(p)
+	if int64(n) > s.remaining {
+		n = int(s.remaining)
+		err = ErrSizeMismatch
+	} else if err == io.EOF && int64(n) < s.remaining {
+		err = ErrSizeMismatch
+	}
+
+	s.remaining -= int64(n)
+
+	return n, err
+}
+
+// UnknownCodecError is returned when a Codec ID has not been registered, and
+// contains the unknown ID.
+type UnknownCodecError uint8
+
+// Error implements the error interface.
+func (u UnknownCodecError) Error() string {
+	return "unknown codec: " + strconv.FormatUint(uint64(u), 10)
+}
+
+// ErrSizeMismatch is returned when the decompressed data of a Node does not
+// match the uncompressed size stored with it.
+var ErrSizeMismatch = errors.New("decompressed size mismatch")
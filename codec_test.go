@@ -0,0 +1,272 @@
+package tree
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"vimagination.zapto.org/byteio"
+)
+
+func TestCompression(t *testing.T) {
+	text := []byte(strings.Repeat(`{"key": "value", "list": [1, 2, 3]}`, 32))
+	tree := genLargeTree(3)
+	tree.children = append(tree.children, node{
+		name: "~text",
+		data: text,
+		children: []node{
+			{
+				name: "short",
+				data: []byte("A"),
+			},
+		},
+	})
+
+	var plain bytes.Buffer
+
+	if err := Serialise(&plain, &tree); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for n, codec := range [...]uint8{CodecFlate, CodecZlib, CodecGzip} {
+		var buf bytes.Buffer
+
+		if err := SerialiseWithOptions(&buf, &tree, Options{Checksums: true, Hash: sha256.New, Compression: codec}); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if buf.Len() >= plain.Len() {
+			t.Errorf("test %d: expecting compressed tree to be smaller than %d bytes, got %d", n+1, plain.Len(), buf.Len())
+		}
+
+		tr := OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+
+		if read := readTree(tr); !reflect.DeepEqual(read, tree) {
+			t.Errorf("test %d: Tree: did not read what we wrote", n+1)
+		}
+
+		m, err := OpenMem(buf.Bytes())
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if read := readTree(m); !reflect.DeepEqual(read, tree) {
+			t.Errorf("test %d: MemTree: did not read what we wrote", n+1)
+		}
+
+		if h, err := Hash(&tree, sha256.New); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if stored, _ := tr.Hash(); !bytes.Equal(h, stored) {
+			t.Errorf("test %d: expecting hash of uncompressed data", n+1)
+		}
+
+		path := slices.Values([]string{"~text"})
+
+		if child, err := tr.Navigate(path); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if l, err := child.DataLen(); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if l != int64(len(text)) {
+			t.Errorf("test %d: Tree: expecting data length %d, got %d", n+1, len(text), l)
+		}
+
+		if child, err := m.Navigate(path); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if l := child.DataLen(); l != int64(len(text)) {
+			t.Errorf("test %d: MemTree: expecting data length %d, got %d", n+1, len(text), l)
+		} else if !bytes.Equal(child.Data(), text) {
+			t.Errorf("test %d: MemTree: expecting decompressed data", n+1)
+		}
+	}
+}
+
+type testCodec struct {
+	codec Codec
+	used  bool
+}
+
+func (t *testCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	t.used = true
+
+	return t.codec.NewWriter(w)
+}
+
+func (t *testCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return t.codec.NewReader(r)
+}
+
+func TestRegisterCodec(t *testing.T) {
+	const id = 0xfe
+
+	codec := &testCodec{
+		codec: codecFuncs{
+			newWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return flate.NewWriter(w, flate.BestSpeed)
+			},
+			newReader: func(r io.Reader) (io.ReadCloser, error) {
+				return flate.NewReader(r), nil
+			},
+		},
+	}
+	tree := node{data: bytes.Repeat([]byte("ABC"), 100)}
+
+	var buf bytes.Buffer
+
+	if err := SerialiseWithOptions(&buf, &tree, Options{Compression: id}); !errors.Is(err, UnknownCodecError(id)) {
+		t.Errorf("expecting error UnknownCodecError(%d), got %v", id, err)
+	}
+
+	RegisterCodec(id, codec)
+
+	if err := SerialiseWithOptions(&buf, &tree, Options{Compression: id}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !codec.used {
+		t.Errorf("expecting registered codec to be used")
+	} else if read := readTree(OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))); !reflect.DeepEqual(read, tree) {
+		t.Errorf("did not read what we wrote")
+	}
+
+	codecs.Lock()
+	delete(codecs.codecs, id)
+	codecs.Unlock()
+
+	if _, err := OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len())).WriteTo(io.Discard); !errors.Is(err, UnknownCodecError(id)) {
+		t.Errorf("Tree: expecting error UnknownCodecError(%d), got %v", id, err)
+	}
+
+	if _, err := OpenMem(buf.Bytes()); !errors.Is(err, UnknownCodecError(id)) {
+		t.Errorf("MemTree: expecting error UnknownCodecError(%d), got %v", id, err)
+	}
+}
+
+func TestCompressionCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := SerialiseWithOptions(&buf, Branch{
+		{Name: "a", Node: Leaf(strings.Repeat("ABC", 100))},
+	}, Options{Compression: CodecFlate}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data := buf.Bytes()
+	data[0] = 0xff
+
+	m, err := OpenMem(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	child, err := m.Child("a")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var v struct {
+		A string `tree:"a"`
+	}
+
+	if err := Unmarshal(m, &v); err == nil {
+		t.Errorf("Unmarshal: expecting error")
+	}
+
+	if _, err := child.SubTree(); err == nil {
+		t.Errorf("SubTree: expecting error")
+	}
+
+	if _, err := fs.ReadFile(FS(m), "a"); err == nil {
+		t.Errorf("ReadFile: expecting error")
+	}
+
+	var diffErr bool
+
+	for _, change := range Diff(m, Branch{{Name: "a", Node: Leaf(strings.Repeat("ABC", 100))}}) {
+		_, diffErr = change.A.(ChildrenError)
+	}
+
+	if !diffErr {
+		t.Errorf("Diff: expecting error")
+	}
+}
+
+func TestCompressionSize(t *testing.T) {
+	text := []byte(strings.Repeat("ABC", 100))
+
+	var compressed bytes.Buffer
+
+	fw, _ := flate.NewWriter(&compressed, flate.BestCompression)
+
+	fw.Write(text)
+	fw.Close()
+
+	for n, rawSize := range [...]uint64{
+		uint64(len(text)) - 1,
+		uint64(len(text)) + 1,
+		1 << 62,
+	} {
+		var record, sizes, data bytes.Buffer
+
+		rw := byteio.StickyLittleEndianWriter{Writer: &record}
+
+		rw.WriteUint8(CodecFlate)
+		rw.WriteUintX(rawSize)
+
+		w := byteio.StickyLittleEndianWriter{Writer: &data}
+
+		w.Write(compressed.Bytes())
+		w.WriteUint8(extCompressed)
+		w.WriteUintX(uint64(record.Len()))
+		w.Write(record.Bytes())
+
+		sw := byteio.StickyLittleEndianWriter{Writer: &sizes}
+
+		sw.WriteUintX(uint64(compressed.Len()))
+		sw.WriteUintX(uint64(data.Len() - compressed.Len()))
+		w.Write(sizes.Bytes())
+		w.WriteUint8(byte(sizes.Len()))
+		w.WriteUint8(0xa0)
+
+		leaf := data.Len()
+
+		w.Write([]byte{'a', byte(leaf), 0x08, 0x01, 0x41})
+
+		tr, err := OpenAt(bytes.NewReader(data.Bytes()), int64(data.Len())).Child("a")
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if _, err := tr.WriteTo(io.Discard); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("test %d: Tree: expecting ErrSizeMismatch, got %v", n+1, err)
+		}
+
+		m, err := OpenMem(data.Bytes())
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		child, err := m.Child("a")
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if d := child.Data(); d != nil {
+			t.Errorf("test %d: MemTree: expecting nil data, got %d bytes", n+1, len(d))
+		}
+
+		if _, err := child.SubTree(); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("test %d: SubTree: expecting ErrSizeMismatch, got %v", n+1, err)
+		}
+
+		if _, err := fs.ReadFile(FS(m), "a"); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("test %d: ReadFile: expecting ErrSizeMismatch, got %v", n+1, err)
+		}
+
+		if err := Verify(bytes.NewReader(data.Bytes()), int64(data.Len())); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("test %d: Verify: expecting ErrSizeMismatch, got %v", n+1, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package tree
+
+import (
+	"bytes"
+	"io"
+	"iter"
+	"slices"
+)
+
+// ChangeKind is a bitmask describing how a Node differs between two trees.
+type ChangeKind uint8
+
+const (
+	// Added indicates that the Node only exists in the second tree.
+	Added ChangeKind = 1 << iota
+
+	// Removed indicates that the Node only exists in the first tree.
+	Removed
+
+	// DataChanged indicates that the data stored on the Node differs.
+	DataChanged
+
+	// ChildrenChanged indicates that the names of the children of the Node
+	// differ.
+	ChildrenChanged
+)
+
+// Change describes how a Node differs between two trees.
+//
+// For an Added Node, A will be nil, and for a Removed Node, B will be nil.
+type Change struct {
+	Kind ChangeKind
+	A, B Node
+}
+
+// Diff walks the two trees in lockstep, yielding the path and Change for each
+// Node that differs, in lexical order.
+//
+// For an Added or Removed Node, none of its children will be yielded.
+//
+// A Node that exists in both trees will be yielded before any of its children
+// if its data or its set of child names differs.
+//
+// Read errors will be expressed with a final Change with a zero Kind, and with
+// both Nodes being of underlying type ChildrenError.
+func Diff(a, b Node) iter.Seq2[[]string, Change] {
+	return func(yield func([]string, Change) bool) {
+		diff(nil, a, b, yield)
+	}
+}
+
+func diff(path []string, a, b Node, yield func([]string, Change) bool) bool {
+	var kind ChangeKind
+
+	ac, err := sortedChildren(a)
+	if err != nil {
+		return yieldDiffError(path, err, yield)
+	}
+
+	bc, err := sortedChildren(b)
+	if err != nil {
+		return yieldDiffError(path, err, yield)
+	}
+
+	if eq, err := dataEqual(a, b); err != nil {
+		return yieldDiffError(path, err, yield)
+	} else if !eq {
+		kind |= DataChanged
+	}
+
+	if !slices.EqualFunc(ac, bc, func(a, b nameNode) bool { return a.Name == b.Name }) {
+		kind |= ChildrenChanged
+	}
+
+	if kind != 0 && !yield(slices.Clone(path), Change{Kind: kind, A: a, B: b}) {
+		return false
+	}
+
+	for len(ac) > 0 || len(bc) > 0 {
+		var cmp int
+
+		if len(ac) == 0 {
+			cmp = 1
+		} else if len(bc) == 0 {
+			cmp = -1
+		} else {
+			cmp = ac[0].compare(bc[0])
+		}
+
+		switch {
+		case cmp < 0:
+			if !yield(append(slices.Clone(path), ac[0].Name), Change{Kind: Removed, A: ac[0].Node}) {
+				return false
+			}
+
+			ac = ac[1:]
+		case cmp > 0:
+			if !yield(append(slices.Clone(path), bc[0].Name), Change{Kind: Added, B: bc[0].Node}) {
+				return false
+			}
+
+			bc = bc[1:]
+		default:
+			if !diff(append(path, ac[0].Name), ac[0].Node, bc[0].Node, yield) {
+				return false
+			}
+
+			ac = ac[1:]
+			bc = bc[1:]
+		}
+	}
+
+	return true
+}
+
+func yieldDiffError(path []string, err error, yield func([]string, Change) bool) bool {
+	ce := ChildrenError{err}
+
+	yield(slices.Clone(path), Change{A: ce, B: ce})
+
+	return false
+}
+
+func sortedChildren(node Node) (Branch, error) {
+	var b Branch
+
+	for name, child := range node.Children() {
+		if ce, ok := child.(ChildrenError); ok {
+			return nil, ce.error
+		}
+
+		b = append(b, nameNode{Name: name, Node: child})
+	}
+
+	if !slices.IsSortedFunc(b, nameNode.compare) {
+		slices.SortFunc(b, nameNode.compare)
+	}
+
+	return b, nil
+}
+
+func dataEqual(a, b Node) (bool, error) {
+	al, aok, err := dataLen(a)
+	if err != nil {
+		return false, err
+	}
+
+	bl, bok, err := dataLen(b)
+	if err != nil {
+		return false, err
+	}
+
+	if aok && bok && al != bl {
+		return false, nil
+	}
+
+	ar, err := dataReader(a)
+	if err != nil {
+		return false, err
+	}
+
+	if c, ok := ar.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	br, err := dataReader(b)
+	if err != nil {
+		return false, err
+	}
+
+	if c, ok := br.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	var abuf, bbuf [32768]byte
+
+	for {
+		an, aerr := io.ReadFull(ar, abuf[:])
+		bn, berr := io.ReadFull(br, bbuf[:])
+
+		if aerr != nil && aerr != io.EOF && aerr != io.ErrUnexpectedEOF {
+			return false, aerr
+		} else if berr != nil && berr != io.EOF && berr != io.ErrUnexpectedEOF {
+			return false, berr
+		} else if !bytes.Equal(abuf[:an], bbuf[:bn]) {
+			return false, nil
+		} else if aerr != nil || berr != nil {
+			return aerr != nil && berr != nil, nil
+		}
+	}
+}
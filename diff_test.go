@@ -0,0 +1,89 @@
+package tree
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	b := Branch{
+		{"A1", Branch{
+			{"B1", Leaf("456")},
+			{"B2", Leaf("789")},
+			{"B3", Leaf("ABC")},
+			{"B4", Leaf("")},
+		}},
+		{"A2", Branch{
+			{"B1", Leaf("GHI")},
+			{"B3", Branch{
+				{"C1", Leaf("123")},
+			}},
+		}},
+		{"A3", Leaf("")},
+	}
+
+	var buf bytes.Buffer
+
+	Serialise(&buf, b)
+
+	m, _ := OpenMem(buf.Bytes())
+	expected := []struct {
+		path []string
+		kind ChangeKind
+	}{
+		{nil, DataChanged | ChildrenChanged},
+		{[]string{"A1"}, DataChanged},
+		{[]string{"A2"}, DataChanged | ChildrenChanged},
+		{[]string{"A2", "B2"}, Removed},
+		{[]string{"A2", "B3"}, Added},
+		{[]string{"A3"}, Added},
+	}
+
+	for n, test := range [...]struct {
+		a, b Node
+	}{
+		{testChild, b},
+		{OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len())), testChild},
+		{testChild, m},
+	} {
+		var changes []struct {
+			path []string
+			kind ChangeKind
+		}
+
+		for path, change := range Diff(test.a, test.b) {
+			changes = append(changes, struct {
+				path []string
+				kind ChangeKind
+			}{path, change.Kind})
+		}
+
+		if n == 1 {
+			for c := range changes {
+				switch changes[c].kind {
+				case Added:
+					changes[c].kind = Removed
+				case Removed:
+					changes[c].kind = Added
+				}
+			}
+		}
+
+		if !reflect.DeepEqual(changes, expected) {
+			t.Errorf("test %d: expecting changes %v, got %v", n+1, expected, changes)
+		}
+	}
+
+	for path, change := range Diff(testChild, testChild) {
+		t.Errorf("unexpected change at %v: %v", path, change)
+	}
+
+	for path, change := range Diff(testChild, errorWriter{}) {
+		if change.Kind != 0 {
+			t.Errorf("expecting error change, got %v at %v", change, path)
+		} else if _, ok := change.B.(ChildrenError); !ok {
+			t.Errorf("expecting ChildrenError, got %T", change.B)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package tree
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+
+	"vimagination.zapto.org/byteio"
+)
+
+var extNames = map[uint8]string{
+	extCompressed:  "compressed",
+	extPrefixNames: "prefix names",
+	extChecksum:    "checksum",
+	extHash:        "hash",
+	extMetadata:    "metadata",
+	extHashIndex:   "hash index",
+}
+
+type dumper struct {
+	r       io.ReaderAt
+	size    int64
+	pending []int64
+	seen    map[int64]struct{}
+	err     error
+}
+
+// Dump writes an annotated hex dump of the tree stored in the given
+// io.ReaderAt to w, where size is the length of the data, or the pointer to
+// the root Node.
+//
+// Each Node in the tree is printed once, in the order they are stored, with
+// each section of the Node, as described in the documentation for Serialise,
+// broken down into its fields, giving the offset and raw bytes of each field
+// along with its decoded value.
+//
+// Malformed Nodes are reported in the output, with the first such error being
+// returned once as much of the tree as possible has been dumped.
+func Dump(w io.Writer, r io.ReaderAt, size int64) error {
+	d := dumper{
+		r:    r,
+		size: size,
+		seen: make(map[int64]struct{}),
+	}
+
+	var nodes []*dumpNode
+
+	d.push(size)
+
+	for len(d.pending) > 0 {
+		ptr := d.pending[0]
+		d.pending = d.pending[1:]
+
+		node, err := d.parse(ptr)
+		if err != nil && d.err == nil {
+			d.err = err
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	slices.SortFunc(nodes, func(a, b *dumpNode) int {
+		return cmp.Compare(a.start, b.start)
+	})
+
+	for _, node := range nodes {
+		if err := node.print(w); err != nil {
+			return err
+		}
+	}
+
+	return d.err
+}
+
+func (d *dumper) push(ptr int64) {
+	if ptr == 0 {
+		return
+	}
+
+	if _, ok := d.seen[ptr]; !ok {
+		d.seen[ptr] = struct{}{}
+		d.pending = append(d.pending, ptr)
+	}
+}
+
+type dumpField struct {
+	offset int64
+	data   []byte
+	desc   string
+}
+
+type dumpSection struct {
+	name   string
+	offset int64
+	length int64
+	fields []dumpField
+}
+
+type dumpNode struct {
+	ptr, start int64
+	sections   []*dumpSection
+	err        error
+}
+
+func (d *dumper) read(offset, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 || offset+length > d.size {
+		return nil, ErrInvalidNode
+	}
+
+	buf := make([]byte, length)
+
+	if _, err := d.r.ReadAt(buf, offset); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func (d *dumper) parse(ptr int64) (*dumpNode, error) {
+	node := &dumpNode{ptr: ptr, start: ptr}
+	node.err = d.parseNode(node)
+
+	return node, node.err
+}
+
+func (d *dumper) parseNode(node *dumpNode) error {
+	ptr := node.ptr
+
+	flags, err := d.read(ptr-1, 1)
+	if err != nil {
+		return err
+	}
+
+	var (
+		f             = flags[0]
+		sizesLen      = int64(f & 0x1f)
+		hasChildren   = f&0x40 != 0
+		hasData       = f&0x20 != 0
+		hasExtensions = f&0x80 != 0
+		extended      = sizesLen == 0 && hasExtensions
+		flagDesc      = fmt.Sprintf("sizes %d bytes", sizesLen)
+	)
+
+	if extended {
+		flagDesc = "extended"
+	}
+
+	if hasData {
+		flagDesc += ", data"
+	}
+
+	if hasChildren {
+		flagDesc += ", children"
+	}
+
+	if hasExtensions {
+		flagDesc += ", extensions"
+	}
+
+	flagSection := &dumpSection{name: "Size Flags", offset: ptr - 1, length: 1, fields: []dumpField{{offset: ptr - 1, data: flags, desc: flagDesc}}}
+	node.sections = []*dumpSection{flagSection}
+	node.start = ptr - 1
+
+	if extended {
+		length, err := d.read(ptr-2, 1)
+		if err != nil {
+			return err
+		}
+
+		sizesLen = int64(length[0])
+		node.start = ptr - 2
+		node.sections = append([]*dumpSection{{name: "Sizes Length", offset: ptr - 2, length: 1, fields: []dumpField{{offset: ptr - 2, data: length, desc: fmt.Sprintf("sizes %d bytes", sizesLen)}}}}, node.sections...)
+
+		if sizesLen&0xe0 != 0 {
+			return ErrInvalidNode
+		}
+	}
+
+	sizes, err := d.read(node.start-sizesLen, sizesLen)
+	if err != nil {
+		return err
+	}
+
+	sizesSection := &dumpSection{name: "Sizes", offset: node.start - sizesLen, length: sizesLen}
+	node.sections = append([]*dumpSection{sizesSection}, node.sections...)
+	node.start = sizesSection.offset
+
+	var childrenSize, dataSize, extSize int64
+
+	sr := byteio.StickyLittleEndianReader{Reader: bytes.NewReader(sizes)}
+
+	for _, size := range [...]struct {
+		set  bool
+		name string
+		val  *int64
+	}{
+		{hasChildren, "NameSizes", &childrenSize},
+		{hasData, "Data", &dataSize},
+		{hasExtensions, "Extensions", &extSize},
+	} {
+		if !size.set {
+			continue
+		}
+
+		start := sr.Count
+		*size.val = int64(sr.ReadUintX())
+
+		if sr.Err != nil {
+			return fmt.Errorf("invalid sizes section: %w", sr.Err)
+		}
+
+		sizesSection.fields = append(sizesSection.fields, dumpField{
+			offset: sizesSection.offset + start,
+			data:   sizes[start:sr.Count],
+			desc:   fmt.Sprintf("%s size: %d", size.name, *size.val),
+		})
+	}
+
+	if sr.Count != sizesLen {
+		return ErrInvalidNode
+	}
+
+	extStart := sizesSection.offset - extSize
+	dataStart := extStart - dataSize
+	nameSizesStart := dataStart - childrenSize
+
+	if nameSizesStart < 0 || childrenSize < 0 || dataSize < 0 || extSize < 0 {
+		return ErrInvalidNode
+	}
+
+	var restart int
+
+	if extSize > 0 {
+		var section *dumpSection
+
+		section, restart, err = d.parseExtensions(extStart, extSize)
+		node.sections = append([]*dumpSection{section}, node.sections...)
+		node.start = extStart
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if dataSize > 0 {
+		section, err := d.parseData(dataStart, dataSize)
+		node.sections = append([]*dumpSection{section}, node.sections...)
+		node.start = dataStart
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if childrenSize > 0 {
+		sections, err := d.parseChildren(nameSizesStart, childrenSize, restart)
+		node.sections = append(sections, node.sections...)
+
+		if len(sections) > 0 {
+			node.start = sections[0].offset
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *dumper) parseData(start, length int64) (*dumpSection, error) {
+	section := &dumpSection{name: "Data", offset: start, length: length}
+
+	data, err := d.read(start, min(length, 16))
+	if err != nil {
+		return section, err
+	}
+
+	section.fields = append(section.fields, dumpField{
+		offset: start,
+		data:   data,
+		desc:   fmt.Sprintf("%d bytes", length),
+	})
+
+	return section, nil
+}
+
+func (d *dumper) parseExtensions(start, length int64) (*dumpSection, int, error) {
+	section := &dumpSection{name: "Extensions", offset: start, length: length}
+
+	data, err := d.read(start, length)
+	if err != nil {
+		return section, 0, err
+	}
+
+	var restart int
+
+	for n, pos := 0, int64(0); pos < length; n++ {
+		sr := byteio.StickyLittleEndianReader{Reader: bytes.NewReader(data[pos:])}
+		typ := sr.ReadUint8()
+		ul := sr.ReadUintX()
+
+		if sr.Err != nil || ul > uint64(length-pos-sr.Count) {
+			return section, 0, ErrInvalidExtension
+		}
+
+		l := int64(ul)
+
+		name, ok := extNames[typ]
+		if !ok {
+			name = "unknown"
+		}
+
+		end := pos + sr.Count + l
+		section.fields = append(section.fields, dumpField{
+			offset: start + pos,
+			data:   data[pos:end],
+			desc:   fmt.Sprintf("Extension %d: type 0x%02x (%s), %d bytes", n, typ, name, l),
+		})
+
+		if typ == extPrefixNames {
+			if restart, err = parsePrefixRestart(data[pos+sr.Count : end]); err != nil {
+				return section, 0, err
+			}
+		}
+
+		pos = end
+	}
+
+	return section, restart, nil
+}
+
+func (d *dumper) parseChildren(start, length int64, restart int) ([]*dumpSection, error) {
+	nameSizes := &dumpSection{name: "NameSizes", offset: start, length: length}
+	sections := []*dumpSection{nameSizes}
+
+	data, err := d.read(start, length)
+	if err != nil {
+		return sections, err
+	}
+
+	var (
+		nameLens  []childNameSizes
+		ptrWidths []int64
+		namesLen  int64
+		ptrsLen   int64
+	)
+
+	sr := byteio.StickyLittleEndianReader{Reader: bytes.NewReader(data)}
+
+	for n := 0; sr.Count < length; n++ {
+		pos := sr.Count
+		ls := sr.ReadUintX()
+
+		if sr.Err != nil {
+			return sections, fmt.Errorf("invalid NameSizes section: %w", sr.Err)
+		}
+
+		nameLen, ptrWidth := int64(ls>>3), int64(ls&7)+1
+		nameLens = append(nameLens, childNameSizes{nameStart: namesLen, nameLength: nameLen})
+		ptrWidths = append(ptrWidths, ptrWidth)
+		namesLen += nameLen
+		ptrsLen += ptrWidth
+
+		nameSizes.fields = append(nameSizes.fields, dumpField{
+			offset: start + pos,
+			data:   data[pos:sr.Count],
+			desc:   fmt.Sprintf("NameSize %d: name %d bytes, pointer %d bytes", n, nameLen, ptrWidth),
+		})
+
+		if namesLen > start-ptrsLen {
+			return sections, ErrInvalidNode
+		}
+	}
+
+	ptrsStart := start - ptrsLen
+	pointers := &dumpSection{name: "Pointers", offset: ptrsStart, length: ptrsLen}
+	namesStart := ptrsStart - namesLen
+	names := &dumpSection{name: "Names", offset: namesStart, length: namesLen}
+	sections = []*dumpSection{names, pointers, nameSizes}
+
+	ptrData, err := d.read(ptrsStart, ptrsLen)
+	if err != nil {
+		return sections, err
+	}
+
+	nameData, err := d.read(namesStart, namesLen)
+	if err != nil {
+		return sections, err
+	}
+
+	decoded, err := decodeNames(nameData, nameLens, 0, restart)
+	if err != nil {
+		return sections, err
+	}
+
+	var ptrPos int64
+
+	for n, nameLen := range nameLens {
+		name := nameData[nameLen.nameStart : nameLen.nameStart+nameLen.nameLength]
+		desc := fmt.Sprintf("Name %d: %q", n, decoded[n])
+
+		if restart > 0 && n%restart != 0 {
+			desc += fmt.Sprintf(" (shared %d)", sharedPrefix(decoded[n-1], decoded[n]))
+		}
+
+		ptrBytes := byteio.MemLittleEndian(ptrData[ptrPos : ptrPos+ptrWidths[n]])
+		ptr := readChildPointer(&ptrBytes, uint8(ptrWidths[n]))
+
+		names.fields = append(names.fields, dumpField{
+			offset: namesStart + nameLen.nameStart,
+			data:   name,
+			desc:   desc,
+		})
+		pointers.fields = append(pointers.fields, dumpField{
+			offset: ptrsStart + ptrPos,
+			data:   ptrData[ptrPos : ptrPos+ptrWidths[n]],
+			desc:   fmt.Sprintf("Pointer %d: 0x%x", n, ptr),
+		})
+
+		ptrPos += ptrWidths[n]
+
+		if ptr > namesStart {
+			return sections, fmt.Errorf("pointer 0x%x: %w", ptr, ErrInvalidPointer)
+		}
+
+		d.push(ptr)
+	}
+
+	return sections, nil
+}
+
+func (n *dumpNode) print(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "Node 0x%x [0x%x, 0x%x)\n", n.ptr, n.start, n.ptr); err != nil {
+		return err
+	}
+
+	for _, section := range n.sections {
+		if _, err := fmt.Fprintf(w, "  %s @ 0x%x, %d bytes\n", section.name, section.offset, section.length); err != nil {
+			return err
+		}
+
+		for _, field := range section.fields {
+			data := field.data
+			suffix := ""
+
+			if len(data) > 8 {
+				data = data[:8]
+				suffix = "..."
+			}
+
+			if _, err := fmt.Fprintf(w, "    %08x  %-27s  %s\n", field.offset, hexBytes(data)+suffix, field.desc); err != nil {
+				return err
+			}
+		}
+	}
+
+	if n.err != nil {
+		if _, err := fmt.Fprintf(w, "  error: %s\n", n.err); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func hexBytes(data []byte) string {
+	var buf bytes.Buffer
+
+	for n, b := range data {
+		if n > 0 {
+			buf.WriteByte(' ')
+		}
+
+		buf.WriteString(hex.EncodeToString([]byte{b}))
+	}
+
+	return buf.String()
+}
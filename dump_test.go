@@ -0,0 +1,141 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := Serialise(&buf, Branch{
+		{Name: "A", Node: Leaf("hello")},
+		{Name: "B", Node: Branch{{Name: "C", Node: Leaf("")}}},
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var out bytes.Buffer
+
+	if err := Dump(&out, bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	const expected = `Node 0x7 [0x0, 0x7)
+  Data @ 0x0, 5 bytes
+    00000000  68 65 6c 6c 6f               5 bytes
+  Sizes @ 0x5, 1 bytes
+    00000005  05                           Data size: 5
+  Size Flags @ 0x6, 1 bytes
+    00000006  21                           sizes 1 bytes, data
+Node 0xc [0x7, 0xc)
+  Names @ 0x7, 1 bytes
+    00000007  43                           Name 0: "C"
+  Pointers @ 0x8, 1 bytes
+    00000008  00                           Pointer 0: 0x0
+  NameSizes @ 0x9, 1 bytes
+    00000009  08                           NameSize 0: name 1 bytes, pointer 1 bytes
+  Sizes @ 0xa, 1 bytes
+    0000000a  01                           NameSizes size: 1
+  Size Flags @ 0xb, 1 bytes
+    0000000b  41                           sizes 1 bytes, children
+Node 0x14 [0xc, 0x14)
+  Names @ 0xc, 2 bytes
+    0000000c  41                           Name 0: "A"
+    0000000d  42                           Name 1: "B"
+  Pointers @ 0xe, 2 bytes
+    0000000e  07                           Pointer 0: 0x7
+    0000000f  0c                           Pointer 1: 0xc
+  NameSizes @ 0x10, 2 bytes
+    00000010  08                           NameSize 0: name 1 bytes, pointer 1 bytes
+    00000011  08                           NameSize 1: name 1 bytes, pointer 1 bytes
+  Sizes @ 0x12, 1 bytes
+    00000012  02                           NameSizes size: 2
+  Size Flags @ 0x13, 1 bytes
+    00000013  41                           sizes 1 bytes, children
+`
+
+	if got := out.String(); got != expected {
+		t.Errorf("expecting output:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestDumpMalformed(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  []byte
+		Output string
+	}{
+		{ // sizes beyond start of data
+			Input: []byte{0x05, 0x21},
+			Output: `Node 0x2 [0x0, 0x2)
+  Sizes @ 0x0, 1 bytes
+    00000000  05                           Data size: 5
+  Size Flags @ 0x1, 1 bytes
+    00000001  21                           sizes 1 bytes, data
+  error: invalid node
+`,
+		},
+		{ // child pointer beyond end of data
+			Input: []byte{'A', 0xff, 0x08, 0x01, 0x41},
+			Output: `Node 0x5 [0x0, 0x5)
+  Names @ 0x0, 1 bytes
+    00000000  41                           Name 0: "A"
+  Pointers @ 0x1, 1 bytes
+    00000001  ff                           Pointer 0: 0xff
+  NameSizes @ 0x2, 1 bytes
+    00000002  08                           NameSize 0: name 1 bytes, pointer 1 bytes
+  Sizes @ 0x3, 1 bytes
+    00000003  01                           NameSizes size: 1
+  Size Flags @ 0x4, 1 bytes
+    00000004  41                           sizes 1 bytes, children
+  error: pointer 0xff: invalid child pointer
+`,
+		},
+		{ // child pointer to own node
+			Input: []byte{'A', 0x05, 0x08, 0x01, 0x41},
+			Output: `Node 0x5 [0x0, 0x5)
+  Names @ 0x0, 1 bytes
+    00000000  41                           Name 0: "A"
+  Pointers @ 0x1, 1 bytes
+    00000001  05                           Pointer 0: 0x5
+  NameSizes @ 0x2, 1 bytes
+    00000002  08                           NameSize 0: name 1 bytes, pointer 1 bytes
+  Sizes @ 0x3, 1 bytes
+    00000003  01                           NameSizes size: 1
+  Size Flags @ 0x4, 1 bytes
+    00000004  41                           sizes 1 bytes, children
+  error: pointer 0x5: invalid child pointer
+`,
+		},
+		{ // truncated extension record
+			Input: []byte{0x80, 0x04, 0x02, 0x81},
+			Output: `Node 0x4 [0x0, 0x4)
+  Extensions @ 0x0, 2 bytes
+  Sizes @ 0x2, 1 bytes
+    00000002  02                           Extensions size: 2
+  Size Flags @ 0x3, 1 bytes
+    00000003  81                           sizes 1 bytes, extensions
+  error: invalid extension
+`,
+		},
+	} {
+		var out bytes.Buffer
+
+		if err := Dump(&out, bytes.NewReader(test.Input), int64(len(test.Input))); err == nil {
+			t.Errorf("test %d: expecting error, got nil", n+1)
+		} else if got := out.String(); got != test.Output {
+			t.Errorf("test %d: expecting output:\n%s\ngot:\n%s", n+1, test.Output, got)
+		}
+	}
+
+	if err := Dump(new(bytes.Buffer), bytes.NewReader(nil), 0); err != nil {
+		t.Errorf("expecting nil error for empty tree, got %s", err)
+	}
+
+	var out bytes.Buffer
+
+	if err := Dump(&out, bytes.NewReader([]byte{0x01}), 1); !errors.Is(err, ErrInvalidNode) {
+		t.Errorf("expecting out of bounds error, got %v", err)
+	}
+}
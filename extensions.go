@@ -0,0 +1,264 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strconv"
+
+	"vimagination.zapto.org/byteio"
+)
+
+const (
+	// Extension types with this bit set may be ignored by readers that do
+	// not understand them; all other types must be understood in order to
+	// read the Node.
+	extOptional = 0x80
+
+	extCompressed  = 0x01
+	extPrefixNames = 0x02
+
+	extChecksum  = extOptional | 0
+	extHash      = extOptional | 1
+	extMetadata  = extOptional | 2
+	extHashIndex = extOptional | 3
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type extensions struct {
+	codec         Codec
+	rawSize       int64
+	restart       int
+	hashID        []byte
+	hash          []byte
+	metadata      *Metadata
+	index         *hashIndex
+	hasChecksum   bool
+	checksum      uint32
+	checksumStart int64
+}
+
+func (w *writer) writeExtensions(c children, layout []childNameSizes, restart int, hash []byte, rawSize int64, meta *Metadata) {
+	var buf bytes.Buffer
+
+	if rawSize >= 0 {
+		bw := byteio.StickyLittleEndianWriter{Writer: &buf}
+
+		bw.WriteUint8(w.Compression)
+		bw.WriteUintX(uint64(rawSize))
+
+		w.writeExtension(extCompressed, buf.Bytes())
+	}
+
+	if restart > 0 {
+		w.writeExtension(extPrefixNames, prefixRecord(restart))
+	}
+
+	if meta != nil {
+		buf.Reset()
+		meta.appendTo(&buf)
+
+		w.writeExtension(extMetadata, buf.Bytes())
+	}
+
+	if hash != nil {
+		w.writeExtension(extHash, append(w.hashID[:len(w.hashID):len(w.hashID)], hash...))
+	}
+
+	if w.HashIndexThreshold > 0 && len(c) >= w.HashIndexThreshold {
+		w.writeExtension(extHashIndex, buildHashIndex(c, layout))
+	}
+}
+
+// checksumRecordSize is the size of the checksum extension record, which is
+// always the last record in the Extensions section.
+const checksumRecordSize = 6
+
+// writeChecksum writes the checksum extension record, with a checksum of all
+// of the Node written so far, followed by the given Sizes section and flags.
+func (w *writer) writeChecksum(sizes []byte) {
+	w.checksum.Write(sizes)
+
+	sum := w.checksum.Sum32()
+
+	w.WriteUint8(extChecksum)
+	w.WriteUintX(4)
+	w.WriteUint32(sum)
+}
+
+func (w *writer) writeExtension(typ uint8, data []byte) {
+	w.WriteUint8(typ)
+	w.WriteUintX(uint64(len(data)))
+	w.Write(data)
+}
+
+// maxBufferedExtensions is the largest Extensions section that will be read in
+// a single call; larger sections, which will contain a hash index, are instead
+// read a record at a time, leaving the index to be read in place.
+const maxBufferedExtensions = 1024
+
+func readExtensions(r io.ReaderAt, start, length int64) (extensions, error) {
+	if length == 0 {
+		return extensions{}, nil
+	}
+
+	if length <= maxBufferedExtensions {
+		data := make([]byte, length)
+
+		if _, err := r.ReadAt(data, start); err != nil {
+			return extensions{}, err
+		}
+
+		r = &OffsetReaderAt{ReaderAt: bytes.NewReader(data), Offset: start}
+	}
+
+	return parseExtensions(r, start, length)
+}
+
+func parseExtensions(r io.ReaderAt, start, length int64) (extensions, error) {
+	var e extensions
+
+	for end := start + length; start < end; {
+		header := make([]byte, min(end-start, 10))
+
+		if _, err := r.ReadAt(header, start); err != nil {
+			return e, err
+		}
+
+		sr := byteio.StickyLittleEndianReader{Reader: bytes.NewReader(header)}
+		typ := sr.ReadUint8()
+		length := sr.ReadUintX()
+
+		if sr.Err != nil || length > uint64(end-start-sr.Count) {
+			return e, ErrInvalidExtension
+		}
+
+		recordStart := start + sr.Count
+
+		if typ == extHashIndex {
+			h, err := parseHashIndex(r, recordStart, int64(length))
+			if err != nil {
+				return e, err
+			}
+
+			e.index = h
+		} else {
+			record := make(byteio.MemLittleEndian, length)
+
+			if length > 0 {
+				if _, err := r.ReadAt(record, recordStart); err != nil {
+					return e, err
+				}
+			}
+
+			if err := e.parseRecord(typ, record, start); err != nil {
+				return e, err
+			} else if typ == extChecksum && recordStart+int64(length) != end {
+				return e, ErrInvalidExtension
+			}
+		}
+
+		start = recordStart + int64(length)
+	}
+
+	return e, nil
+}
+
+func (e *extensions) parseRecord(typ uint8, record byteio.MemLittleEndian, start int64) error {
+	switch typ {
+	case extCompressed:
+		pr := byteio.StickyLittleEndianReader{Reader: bytes.NewReader(record)}
+		id := pr.ReadUint8()
+		e.rawSize = int64(pr.ReadUintX())
+
+		if pr.Err != nil || e.rawSize < 0 {
+			return ErrInvalidExtension
+		}
+
+		codec, err := getCodec(id)
+		if err != nil {
+			return err
+		}
+
+		e.codec = codec
+	case extPrefixNames:
+		restart, err := parsePrefixRestart(record)
+		if err != nil {
+			return err
+		}
+
+		e.restart = restart
+	case extChecksum:
+		if len(record) != 4 {
+			return ErrInvalidExtension
+		}
+
+		e.hasChecksum = true
+		e.checksum = record.ReadUint32()
+		e.checksumStart = start
+	case extHash:
+		if len(record) <= hashIDSize {
+			return ErrInvalidExtension
+		}
+
+		e.hashID = record[:hashIDSize]
+		e.hash = record[hashIDSize:]
+	case extMetadata:
+		m, err := parseMetadata(record)
+		if err != nil {
+			return err
+		}
+
+		e.metadata = m
+	default:
+		if typ&extOptional == 0 {
+			return UnknownExtensionError(typ)
+		}
+	}
+
+	return nil
+}
+
+// verify checks the stored checksum against the Node, from the given start of
+// the Node to the start of the checksum record, followed by the trailer of the
+// Node, containing the Sizes section and flags, that ends at ptr.
+func (e *extensions) verify(r io.ReaderAt, start, ptr, trailer int64) error {
+	crc := crc32.New(castagnoli)
+
+	if _, err := io.Copy(crc, io.NewSectionReader(r, start, e.checksumStart-start)); err != nil {
+		return err
+	} else if _, err := io.Copy(crc, io.NewSectionReader(r, ptr-trailer, trailer)); err != nil {
+		return err
+	}
+
+	if crc.Sum32() != e.checksum {
+		return ChecksumError(ptr)
+	}
+
+	return nil
+}
+
+// ChecksumError is returned when the stored checksum of a Node does not match
+// its contents, and contains the pointer to the corrupted Node.
+type ChecksumError int64
+
+// Error implements the error interface.
+func (c ChecksumError) Error() string {
+	return "checksum mismatch for node at: " + strconv.FormatInt(int64(c), 10)
+}
+
+// UnknownExtensionError is returned when a Node contains a required format
+// extension that is not understood by this reader, and contains the type of
+// the extension.
+type UnknownExtensionError uint8
+
+// Error implements the error interface.
+func (u UnknownExtensionError) Error() string {
+	return "unknown extension type: " + strconv.FormatUint(uint64(u), 10)
+}
+
+// ErrInvalidExtension is returned when the Extensions section of a Node cannot
+// be parsed.
+var ErrInvalidExtension = errors.New("invalid extension")
@@ -0,0 +1,179 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestChecksums(t *testing.T) {
+	tree := genLargeTree(4)
+
+	var buf bytes.Buffer
+
+	if err := SerialiseWithOptions(&buf, &tree, Options{Checksums: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if read := readTree(OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))); !reflect.DeepEqual(read, tree) {
+		t.Errorf("Tree: did not read what we wrote")
+	}
+
+	m, err := OpenMem(buf.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if read := readTree(m); !reflect.DeepEqual(read, tree) {
+		t.Errorf("MemTree: did not read what we wrote")
+	}
+
+	buf.Reset()
+
+	SerialiseWithOptions(&buf, testChild, Options{Checksums: true})
+
+	data := buf.Bytes()
+	data[bytes.Index(data, []byte("JKL"))] = 'j'
+	path := slices.Values([]string{"A2", "B2"})
+
+	node, err := OpenAt(bytes.NewReader(data), int64(len(data))).Navigate(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ptr := node.pointer()
+
+	if _, err = node.WriteTo(&buf); !errors.Is(err, ChecksumError(ptr)) {
+		t.Errorf("Tree: expecting ChecksumError(%d), got %v", ptr, err)
+	}
+
+	if m, err = OpenMem(data); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if _, err = m.Navigate(path); !errors.Is(err, ChecksumError(ptr)) {
+		t.Errorf("MemTree: expecting ChecksumError(%d), got %v", ptr, err)
+	}
+}
+
+func TestChecksumCoverage(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := SerialiseWithOptions(&buf, &node{
+		data:     []byte("data"),
+		children: []node{{name: "child"}},
+	}, Options{Checksums: true, Metadata: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := OpenMem(buf.Bytes()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	flags := buf.Bytes()[buf.Len()-1]
+	checksumType := buf.Len() - 1 - int(flags&0x1f) - checksumRecordSize
+
+	for pos := range buf.Len() {
+		if pos == checksumType {
+			continue // an altered type leaves an unknown optional record
+		}
+
+		for bit := range 8 {
+			data := bytes.Clone(buf.Bytes())
+			data[pos] ^= 1 << bit
+
+			if _, err := OpenMem(data); err == nil {
+				t.Errorf("byte %d, bit %d: expecting error", pos, bit)
+			}
+
+			if err := Verify(bytes.NewReader(data), int64(len(data))); err == nil {
+				t.Errorf("byte %d, bit %d: expecting Verify to report an error", pos, bit)
+			}
+		}
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	for n, test := range [...]struct {
+		Input []byte
+		Error error
+	}{
+		{ // 1
+			Input: []byte{'A', extOptional | 0x7f, 1, 0, 1, 3, 0xa0 | 2},
+		},
+		{ // 2
+			Input: []byte{'A', 0x7f, 0, 1, 2, 0xa0 | 2},
+			Error: UnknownExtensionError(0x7f),
+		},
+		{ // 3
+			Input: []byte{'A', extOptional | 0x7f, 2, 0, 1, 3, 0xa0 | 2},
+			Error: ErrInvalidExtension,
+		},
+		{ // 4
+			Input: []byte{'A', extChecksum, 1, 0, 1, 3, 0xa0 | 2},
+			Error: ErrInvalidExtension,
+		},
+		{ // 5
+			Input: []byte{'A', extChecksum, 4, 0, 0, 0, 0, extOptional | 0x7f, 0, 1, 8, 0xa0 | 2},
+			Error: ErrInvalidExtension,
+		},
+	} {
+		var data bytes.Buffer
+
+		if _, err := OpenAt(bytes.NewReader(test.Input), int64(len(test.Input))).WriteTo(&data); !errors.Is(err, test.Error) {
+			t.Errorf("test %d: Tree: expecting error %v, got %v", n+1, test.Error, err)
+		} else if err == nil && data.String() != "A" {
+			t.Errorf("test %d: Tree: expecting data %q, got %q", n+1, "A", data.String())
+		}
+
+		if m, err := OpenMem(test.Input); !errors.Is(err, test.Error) {
+			t.Errorf("test %d: MemTree: expecting error %v, got %v", n+1, test.Error, err)
+		} else if err == nil && string(m.Data()) != "A" {
+			t.Errorf("test %d: MemTree: expecting data %q, got %q", n+1, "A", m.Data())
+		}
+	}
+}
+
+func TestMetadataOption(t *testing.T) {
+	modTime := time.Unix(1234567890, 0)
+	withMeta := Branch{
+		{Name: "a", Node: metaNode{Leaf("123"), &Metadata{Mode: 0o600, ModTime: modTime}}},
+		{Name: "b", Node: metaNode{Leaf(""), &Metadata{Mode: 0o640}}},
+	}
+	withoutMeta := Branch{
+		{Name: "a", Node: Leaf("123")},
+		{Name: "b", Node: Leaf("")},
+	}
+
+	var plain, meta, stored bytes.Buffer
+
+	if err := Serialise(&plain, withoutMeta); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := Serialise(&meta, withMeta); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !bytes.Equal(plain.Bytes(), meta.Bytes()) {
+		t.Errorf("expecting Metadata to not be stored by default")
+	}
+
+	if err := SerialiseWithOptions(&stored, withMeta, Options{Metadata: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	m, err := OpenMem(stored.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, child := range withMeta {
+		expected := child.Node.(metaNode).meta
+
+		if c, err := m.Child(child.Name); err != nil {
+			t.Errorf("%s: unexpected error: %s", child.Name, err)
+		} else if got := c.Metadata(); got == nil || got.Mode != expected.Mode || !got.ModTime.Equal(expected.ModTime) {
+			t.Errorf("%s: expecting metadata %v, got %v", child.Name, expected, got)
+		}
+	}
+}
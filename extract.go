@@ -0,0 +1,297 @@
+package tree
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MixedNode determines how Extract handles a Node that has both data and
+// children.
+type MixedNode uint8
+
+const (
+	// MixedDirectory extracts the Node as a directory, ignoring its data.
+	MixedDirectory MixedNode = iota
+
+	// MixedSidecar extracts the Node as a directory, and writes its data
+	// to a sidecar file alongside the directory, with a name formed by
+	// adding ExtractOptions.SidecarSuffix to the name of the directory.
+	//
+	// If the name of a sidecar file is the same as the file name of a
+	// sibling Node, Extract will return a SidecarCollisionError.
+	MixedSidecar
+
+	// MixedError causes Extract to return ErrMixedNode.
+	MixedError
+)
+
+// Overwrite determines how Extract handles files that already exist.
+type Overwrite uint8
+
+const (
+	// OverwriteNone causes Extract to return an error wrapping
+	// fs.ErrExist when a file already exists.
+	OverwriteNone Overwrite = iota
+
+	// OverwriteReplace replaces any existing file.
+	OverwriteReplace
+
+	// OverwriteSkip leaves any existing file untouched, skipping the Node,
+	// and all of its children.
+	OverwriteSkip
+)
+
+const defaultSidecarSuffix = ".data"
+
+// ExtractOptions contains the options that control how Extract writes a tree
+// to the filesystem.
+type ExtractOptions struct {
+	// Mixed sets the handling of Nodes that have both data and children.
+	Mixed MixedNode
+
+	// SidecarSuffix is the suffix added to the name of a directory to
+	// create the name of the sidecar file when Mixed is set to
+	// MixedSidecar. Defaults to ".data" when empty.
+	SidecarSuffix string
+
+	// Sanitise, when set, is used to convert the name of each Node to a
+	// file name. When not set, any '/', NUL, or OS path separator in the
+	// name will be replaced with '_'.
+	//
+	// Any resulting name that is empty, "." or "..", or still contains one
+	// of those characters, will cause Extract to return an
+	// InvalidNameError, and any resulting name that is the same as that of
+	// a sibling will cause Extract to return a NameCollisionError.
+	Sanitise func(name string) string
+
+	// Overwrite sets the handling of files that already exist.
+	//
+	// Existing directories are always written into.
+	Overwrite Overwrite
+}
+
+// Extract writes the given tree to the filesystem, rooted at the given
+// directory, which will be created if it does not exist.
+//
+// Each Node with children is written as a directory, and each Node without
+// children is written as a file containing the data of the Node. The root Node
+// is always written as a directory, with any data on it handled as according
+// to the Mixed option.
+//
+// All files are created within the given directory using an os.Root, so no
+// Node name can cause a file to be written outside of it. The one exception is
+// the sidecar file for the data of the root Node, which is written alongside
+// the given directory, with a name formed only from the directory and the
+// SidecarSuffix.
+func Extract(node Node, dir string, opts ExtractOptions) error {
+	if opts.SidecarSuffix == "" {
+		opts.SidecarSuffix = defaultSidecarSuffix
+	}
+
+	if opts.Sanitise == nil {
+		opts.Sanitise = sanitiseName
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+
+	defer root.Close()
+
+	if l, err := nodeDataLen(node); err != nil {
+		return err
+	} else if l > 0 {
+		switch opts.Mixed {
+		case MixedSidecar:
+			if err := opts.writeFile(os.OpenFile, filepath.Clean(dir)+opts.SidecarSuffix, node); err != nil {
+				return err
+			}
+		case MixedError:
+			return ErrMixedNode
+		}
+	}
+
+	return opts.extract(root, node)
+}
+
+func sanitiseName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == 0 || r == os.PathSeparator {
+			return '_'
+		}
+
+		return r
+	}, name)
+}
+
+func (e *ExtractOptions) fileName(name string) (string, error) {
+	fname := e.Sanitise(name)
+
+	if fname == "" || fname == "." || fname == ".." || strings.ContainsAny(fname, "/\x00") || strings.ContainsRune(fname, os.PathSeparator) {
+		return "", InvalidNameError(name)
+	}
+
+	return fname, nil
+}
+
+type extractEntry struct {
+	name string
+	node Node
+}
+
+func (e *ExtractOptions) extract(root *os.Root, node Node) error {
+	var (
+		entries []extractEntry
+		names   = make(map[string]struct{})
+	)
+
+	for name, child := range node.Children() {
+		if ce, ok := child.(ChildrenError); ok {
+			return ce.error
+		}
+
+		fname, err := e.fileName(name)
+		if err != nil {
+			return err
+		} else if _, ok := names[fname]; ok {
+			return NameCollisionError(fname)
+		}
+
+		entries = append(entries, extractEntry{name: fname, node: child})
+		names[fname] = struct{}{}
+	}
+
+	for _, entry := range entries {
+		isDir, err := hasChildren(entry.node)
+		if err != nil {
+			return err
+		}
+
+		if !isDir {
+			err = e.writeFile(root.OpenFile, entry.name, entry.node)
+		} else {
+			err = e.extractDir(root, entry.name, entry.node, names)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *ExtractOptions) extractDir(root *os.Root, name string, node Node, siblings map[string]struct{}) error {
+	if l, err := nodeDataLen(node); err != nil {
+		return err
+	} else if l > 0 {
+		switch e.Mixed {
+		case MixedSidecar:
+			sidecar := name + e.SidecarSuffix
+
+			if _, ok := siblings[sidecar]; ok {
+				return SidecarCollisionError(sidecar)
+			}
+
+			if err := e.writeFile(root.OpenFile, sidecar, node); err != nil {
+				return err
+			}
+		case MixedError:
+			return ErrMixedNode
+		}
+	}
+
+	if err := root.Mkdir(name, 0o755); errors.Is(err, fs.ErrExist) {
+		if fi, err := root.Lstat(name); err != nil {
+			return err
+		} else if !fi.IsDir() {
+			switch e.Overwrite {
+			case OverwriteNone:
+				return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+			case OverwriteSkip:
+				return nil
+			}
+
+			if err := root.Remove(name); err != nil {
+				return err
+			} else if err := root.Mkdir(name, 0o755); err != nil {
+				return err
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+
+	sub, err := root.OpenRoot(name)
+	if err != nil {
+		return err
+	}
+
+	defer sub.Close()
+
+	return e.extract(sub, node)
+}
+
+func (e *ExtractOptions) writeFile(openFile func(string, int, fs.FileMode) (*os.File, error), name string, node Node) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+
+	if e.Overwrite == OverwriteReplace {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	f, err := openFile(name, flags, 0o644)
+	if errors.Is(err, fs.ErrExist) && e.Overwrite == OverwriteSkip {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := node.WriteTo(f); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+// InvalidNameError is returned from Extract when the name of a Node cannot be
+// converted to a valid file name, and contains the name of the Node.
+type InvalidNameError string
+
+// Error implements the error interface.
+func (i InvalidNameError) Error() string {
+	return "invalid file name: " + string(i)
+}
+
+// NameCollisionError is returned from Extract when the names of two sibling
+// Nodes are converted to the same file name, and contains the file name.
+type NameCollisionError string
+
+// Error implements the error interface.
+func (n NameCollisionError) Error() string {
+	return "file name collides with sibling: " + string(n)
+}
+
+// SidecarCollisionError is returned from Extract when the name of a sidecar
+// file is the same as the file name of a sibling Node, and contains the name of
+// the sidecar file.
+type SidecarCollisionError string
+
+// Error implements the error interface.
+func (s SidecarCollisionError) Error() string {
+	return "sidecar file name collides with sibling: " + string(s)
+}
+
+// ErrMixedNode is returned from Extract when a Node has both data and
+// children, and the Mixed option is set to MixedError, and from ToTar for any
+// such Node.
+var ErrMixedNode = errors.New("node has both data and children")
@@ -0,0 +1,243 @@
+package tree
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	mixed := &node{
+		children: []node{
+			{
+				name: "a/b",
+				data: []byte("123"),
+			},
+			{
+				name: "dir",
+				data: []byte("456"),
+				children: []node{
+					{
+						name: "c\x00d",
+						data: []byte("789"),
+					},
+				},
+			},
+		},
+	}
+
+	for n, test := range [...]struct {
+		Input    Node
+		Options  ExtractOptions
+		Existing map[string]string
+		Output   node
+		Error    error
+	}{
+		{ // 1
+			Input: mixed,
+			Output: node{
+				children: []node{
+					{
+						name: "a_b",
+						data: []byte("123"),
+					},
+					{
+						name: "dir",
+						children: []node{
+							{
+								name: "c_d",
+								data: []byte("789"),
+							},
+						},
+					},
+				},
+			},
+		},
+		{ // 2
+			Input:   mixed,
+			Options: ExtractOptions{Mixed: MixedSidecar},
+			Output: node{
+				children: []node{
+					{
+						name: "a_b",
+						data: []byte("123"),
+					},
+					{
+						name: "dir",
+						children: []node{
+							{
+								name: "c_d",
+								data: []byte("789"),
+							},
+						},
+					},
+					{
+						name: "dir.data",
+						data: []byte("456"),
+					},
+				},
+			},
+		},
+		{ // 3
+			Input:   mixed,
+			Options: ExtractOptions{Mixed: MixedError},
+			Error:   ErrMixedNode,
+		},
+		{ // 4
+			Input: Branch{{Name: "..", Node: Leaf("escape")}},
+			Error: InvalidNameError(".."),
+		},
+		{ // 5
+			Input: Branch{{Name: "a", Node: Leaf("b")}},
+			Options: ExtractOptions{
+				Sanitise: func(string) string { return "../a" },
+			},
+			Error: InvalidNameError("a"),
+		},
+		{ // 6
+			Input:    Branch{{Name: "a", Node: Leaf("new")}},
+			Existing: map[string]string{"a": "old"},
+			Error:    fs.ErrExist,
+		},
+		{ // 7
+			Input:    Branch{{Name: "a", Node: Leaf("new")}},
+			Options:  ExtractOptions{Overwrite: OverwriteReplace},
+			Existing: map[string]string{"a": "old"},
+			Output: node{
+				children: []node{
+					{
+						name: "a",
+						data: []byte("new"),
+					},
+				},
+			},
+		},
+		{ // 8
+			Input:    Branch{{Name: "a", Node: Leaf("new")}, {Name: "b", Node: Leaf("new")}},
+			Options:  ExtractOptions{Overwrite: OverwriteSkip},
+			Existing: map[string]string{"a": "old"},
+			Output: node{
+				children: []node{
+					{
+						name: "a",
+						data: []byte("old"),
+					},
+					{
+						name: "b",
+						data: []byte("new"),
+					},
+				},
+			},
+		},
+		{ // 9
+			Input: Branch{
+				{Name: "a", Node: &node{data: []byte("1"), children: []node{{name: "b", data: []byte("2")}}}},
+				{Name: "a.data", Node: Leaf("3")},
+			},
+			Options: ExtractOptions{Mixed: MixedSidecar},
+			Error:   SidecarCollisionError("a.data"),
+		},
+		{ // 10
+			Input: Branch{
+				{Name: "a.data", Node: Leaf("3")},
+				{Name: "a", Node: &node{data: []byte("1"), children: []node{{name: "b", data: []byte("2")}}}},
+			},
+			Options: ExtractOptions{Mixed: MixedSidecar},
+			Error:   SidecarCollisionError("a.data"),
+		},
+		{ // 11
+			Input: Branch{
+				{Name: "a", Node: &node{data: []byte("1"), children: []node{{name: "b", data: []byte("2")}}}},
+				{Name: "a.data", Node: Leaf("3")},
+			},
+			Options: ExtractOptions{Mixed: MixedSidecar, SidecarSuffix: ".side"},
+			Output: node{
+				children: []node{
+					{
+						name: "a",
+						children: []node{
+							{
+								name: "b",
+								data: []byte("2"),
+							},
+						},
+					},
+					{
+						name: "a.data",
+						data: []byte("3"),
+					},
+					{
+						name: "a.side",
+						data: []byte("1"),
+					},
+				},
+			},
+		},
+		{ // 12
+			Input: Branch{
+				{Name: "a/b", Node: Leaf("1")},
+				{Name: "a_b", Node: Leaf("2")},
+			},
+			Error: NameCollisionError("a_b"),
+		},
+		{ // 13
+			Input: Branch{
+				{Name: "a/b", Node: Branch{{Name: "c", Node: Leaf("1")}}},
+				{Name: "a_b", Node: Leaf("2")},
+			},
+			Options: ExtractOptions{Overwrite: OverwriteReplace},
+			Error:   NameCollisionError("a_b"),
+		},
+		{ // 14
+			Input: Branch{
+				{Name: "A", Node: Leaf("1")},
+				{Name: "a", Node: Leaf("2")},
+			},
+			Options: ExtractOptions{Sanitise: strings.ToLower},
+			Error:   NameCollisionError("a"),
+		},
+	} {
+		dir := filepath.Join(t.TempDir(), "out")
+
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		for name, data := range test.Existing {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+				t.Fatalf("test %d: unexpected error: %s", n+1, err)
+			}
+		}
+
+		if err := Extract(test.Input, dir, test.Options); !errors.Is(err, test.Error) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Error, err)
+		} else if err == nil {
+			if read := readTree(FromFS(os.DirFS(dir), ".")); !reflect.DeepEqual(read, test.Output) {
+				t.Errorf("test %d: expecting %v, got %v", n+1, test.Output, read)
+			}
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "..", "escape")); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("test %d: expecting no file outside of the extraction directory", n+1)
+		}
+	}
+}
+
+func TestExtractRootSidecar(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	root := &node{data: []byte("root"), children: []node{{name: "a", data: []byte("1")}}}
+
+	if err := Extract(root, dir, ExtractOptions{Mixed: MixedSidecar}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if data, err := os.ReadFile(dir + ".data"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if string(data) != "root" {
+		t.Errorf("expecting sidecar data %q, got %q", "root", data)
+	}
+}
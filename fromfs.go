@@ -0,0 +1,102 @@
+package tree
+
+import (
+	"io"
+	"io/fs"
+	"iter"
+	"path"
+)
+
+type fsNode struct {
+	fsys  fs.FS
+	path  string
+	typ   fs.FileMode
+	known bool
+}
+
+// FromFS returns a Node that lazily presents the named directory of the given
+// fs.FS as a tree.
+//
+// Each directory is a Node whose children are its entries, and each regular
+// file is a childless Node whose data is the contents of the file. Entries
+// that are neither directories nor regular files, such as symbolic links, are
+// omitted. If root names a regular file, the returned Node will be a childless
+// Node containing the contents of that file.
+//
+// Directories are not listed, and files are not opened, until the Node is
+// walked, and so the returned Node can be passed to Serialise without reading
+// the entire directory hierarchy into memory. Any error encountered will be
+// returned as a ChildrenError from Children, or from WriteTo.
+func FromFS(fsys fs.FS, root string) Node {
+	return fsNode{fsys: fsys, path: root}
+}
+
+func (f fsNode) fileType() (fs.FileMode, error) {
+	if f.known {
+		return f.typ, nil
+	}
+
+	info, err := fs.Stat(f.fsys, f.path)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Mode().Type(), nil
+}
+
+// Children returns an iterator that loops through the entries of the
+// directory, in name order.
+func (f fsNode) Children() iter.Seq2[string, Node] {
+	typ, err := f.fileType()
+	if err != nil {
+		return func(yield func(string, Node) bool) { yield("", ChildrenError{err}) }
+	} else if !typ.IsDir() {
+		return noChildren
+	}
+
+	entries, err := fs.ReadDir(f.fsys, f.path)
+	if err != nil {
+		return func(yield func(string, Node) bool) { yield("", ChildrenError{err}) }
+	}
+
+	return func(yield func(string, Node) bool) {
+		for _, entry := range entries {
+			typ := entry.Type()
+
+			if !typ.IsDir() && !typ.IsRegular() {
+				continue
+			}
+
+			child := fsNode{
+				fsys:  f.fsys,
+				path:  path.Join(f.path, entry.Name()),
+				typ:   typ,
+				known: true,
+			}
+
+			if !yield(entry.Name(), child) {
+				return
+			}
+		}
+	}
+}
+
+// WriteTo writes the contents of a regular file to the given writer, and
+// writes nothing for a directory.
+func (f fsNode) WriteTo(w io.Writer) (int64, error) {
+	typ, err := f.fileType()
+	if err != nil {
+		return 0, err
+	} else if !typ.IsRegular() {
+		return 0, nil
+	}
+
+	file, err := f.fsys.Open(f.path)
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	return io.Copy(w, file)
+}
@@ -0,0 +1,90 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":         {Data: []byte("Hello, World")},
+		"dir/b.txt":     {Data: []byte("123")},
+		"dir/empty":     {},
+		"dir/sub/c.txt": {Data: []byte("456")},
+		"dir/link":      {Data: []byte("a.txt"), Mode: fs.ModeSymlink},
+	}
+
+	for n, test := range [...]struct {
+		Root   string
+		Output node
+		Error  error
+	}{
+		{ // 1
+			Root: ".",
+			Output: node{
+				children: []node{
+					{
+						name: "a.txt",
+						data: []byte("Hello, World"),
+					},
+					{
+						name: "dir",
+						children: []node{
+							{
+								name: "b.txt",
+								data: []byte("123"),
+							},
+							{
+								name: "empty",
+							},
+							{
+								name: "sub",
+								children: []node{
+									{
+										name: "c.txt",
+										data: []byte("456"),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{ // 2
+			Root: "dir/sub",
+			Output: node{
+				children: []node{
+					{
+						name: "c.txt",
+						data: []byte("456"),
+					},
+				},
+			},
+		},
+		{ // 3
+			Root: "a.txt",
+			Output: node{
+				data: []byte("Hello, World"),
+			},
+		},
+		{ // 4
+			Root:  "missing",
+			Error: fs.ErrNotExist,
+		},
+	} {
+		var buf bytes.Buffer
+
+		if err := Serialise(&buf, FromFS(fsys, test.Root)); !errors.Is(err, test.Error) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Error, err)
+		} else if err == nil {
+			if read := readTree(OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))); !reflect.DeepEqual(read, test.Output) {
+				t.Errorf("test %d: expecting %v, got %v", n+1, test.Output, read)
+			}
+		}
+	}
+}
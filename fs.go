@@ -0,0 +1,425 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+)
+
+type treeFS struct {
+	root Node
+}
+
+// FS returns an fs.FS that presents the given Node as a read-only filesystem.
+//
+// Any Node with children is a directory, and any Node without children is a
+// regular file whose contents are the data stored on the Node. As the format
+// allows a Node to have both data and children, such a Node is presented as a
+// directory and its data is not readable through the filesystem; it can
+// instead be accessed via the Node returned from the Sys method of its
+// fs.FileInfo. The root Node is always a directory.
+//
+// Children whose names are not valid fs path elements, such as those that are
+// empty or contain a '/', are omitted from directory listings and cannot be
+// opened.
+//
+// The returned fs.FS also implements fs.ReadDirFS, fs.ReadFileFS, fs.StatFS
+// and fs.SubFS, and any file opened from it implements io.Seeker.
+func FS(node Node) fs.FS {
+	return treeFS{root: node}
+}
+
+// Open opens the named file or directory.
+func (t treeFS) Open(name string) (fs.File, error) {
+	_, info, err := t.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &dir{fileInfo: info}, nil
+	}
+
+	return &file{fileInfo: info}, nil
+}
+
+// ReadDir reads the named directory, returning all of its entries sorted by
+// name.
+func (t treeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	node, info, err := t.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+
+	entries, err := readDir(node)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	return entries, nil
+}
+
+// ReadFile reads the named file and returns its contents.
+func (t treeFS) ReadFile(name string) ([]byte, error) {
+	node, info, err := t.stat("read", name)
+	if err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+
+	var buf bytes.Buffer
+
+	if _, err := node.WriteTo(&buf); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Stat returns a fs.FileInfo describing the named file or directory.
+func (t treeFS) Stat(name string) (fs.FileInfo, error) {
+	_, info, err := t.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// Sub returns an fs.FS corresponding to the subtree rooted at the named
+// directory.
+func (t treeFS) Sub(name string) (fs.FS, error) {
+	node, info, err := t.stat("sub", name)
+	if err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, &fs.PathError{Op: "sub", Path: name, Err: errNotDir}
+	}
+
+	return treeFS{root: node}, nil
+}
+
+func (t treeFS) stat(op, name string) (Node, *fileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		return t.root, &fileInfo{name: ".", node: t.root, dir: true}, nil
+	}
+
+	node, err := Navigate(t.root, strings.SplitSeq(name, "/"))
+	if err != nil {
+		var cnf ChildNotFoundError
+
+		if errors.As(err, &cnf) {
+			err = fs.ErrNotExist
+		}
+
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	info, err := newFileInfo(name[strings.LastIndexByte(name, '/')+1:], node)
+	if err != nil {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	return node, info, nil
+}
+
+func validName(name string) bool {
+	return name != "." && fs.ValidPath(name) && !strings.Contains(name, "/")
+}
+
+func readDir(node Node) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+
+	for name, child := range node.Children() {
+		if ce, ok := child.(ChildrenError); ok {
+			return nil, ce.error
+		}
+
+		if !validName(name) {
+			continue
+		}
+
+		info, err := newFileInfo(name, child)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return entries, nil
+}
+
+type fileInfo struct {
+	name string
+	node Node
+	meta *Metadata
+	size int64
+	dir  bool
+}
+
+func newFileInfo(name string, node Node) (*fileInfo, error) {
+	dir, err := hasChildren(node)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := nodeMetadata(node)
+	if err != nil {
+		return nil, err
+	}
+
+	fi := &fileInfo{name: name, node: node, meta: meta, dir: dir}
+
+	if !dir {
+		if fi.size, err = nodeDataLen(node); err != nil {
+			return nil, err
+		}
+	}
+
+	return fi, nil
+}
+
+func hasChildren(node Node) (bool, error) {
+	switch node := node.(type) {
+	case *Tree:
+		n, err := node.NumChildren()
+
+		return n > 0, err
+	case *TreeCloser:
+		n, err := node.NumChildren()
+
+		return n > 0, err
+	case interface{ NumChildren() int }:
+		return node.NumChildren() > 0, nil
+	}
+
+	for _, child := range node.Children() {
+		if ce, ok := child.(ChildrenError); ok {
+			return false, ce.error
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func numChildren(node Node) (int, error) {
+	switch node := node.(type) {
+	case *Tree:
+		return node.NumChildren()
+	case *TreeCloser:
+		return node.NumChildren()
+	case interface{ NumChildren() int }:
+		return node.NumChildren(), nil
+	}
+
+	var n int
+
+	for _, child := range node.Children() {
+		if ce, ok := child.(ChildrenError); ok {
+			return 0, ce.error
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+func nodeDataLen(node Node) (int64, error) {
+	if l, ok, err := dataLen(node); ok {
+		return l, err
+	}
+
+	return node.WriteTo(io.Discard)
+}
+
+// Name returns the name of the Node.
+func (f *fileInfo) Name() string {
+	return f.name
+}
+
+// Size returns the length of the data of a file, and 0 for a directory.
+func (f *fileInfo) Size() int64 {
+	return f.size
+}
+
+// Mode returns the file mode of the Node, using the permission bits from any
+// stored Metadata, or read-only permissions otherwise.
+func (f *fileInfo) Mode() fs.FileMode {
+	var mode fs.FileMode = 0o444
+
+	if f.meta != nil {
+		mode = f.meta.Mode.Perm()
+	} else if f.dir {
+		mode = 0o555
+	}
+
+	if f.dir {
+		mode |= fs.ModeDir
+	}
+
+	return mode
+}
+
+// ModTime returns the modification time from any stored Metadata, or the zero
+// time otherwise.
+func (f *fileInfo) ModTime() time.Time {
+	if f.meta != nil {
+		return f.meta.ModTime
+	}
+
+	return time.Time{}
+}
+
+// IsDir returns true when the Node has children.
+func (f *fileInfo) IsDir() bool {
+	return f.dir
+}
+
+// Sys returns the underlying Node.
+func (f *fileInfo) Sys() any {
+	return f.node
+}
+
+type file struct {
+	*fileInfo
+	r   io.Reader
+	pos int64
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.fileInfo, nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.r == nil {
+		r, err := dataReader(f.node)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+
+		f.r = r
+	}
+
+	n, err := f.r.Read(p)
+	f.pos += int64(n)
+
+	return n, err
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	rs, ok := f.r.(io.ReadSeeker)
+	if !ok {
+		r, err := dataReader(f.node)
+		if err != nil {
+			return 0, &fs.PathError{Op: "seek", Path: f.name, Err: err}
+		}
+
+		if rs, ok = r.(io.ReadSeeker); !ok {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return 0, &fs.PathError{Op: "seek", Path: f.name, Err: err}
+			}
+
+			rs = bytes.NewReader(data)
+		}
+
+		f.close()
+
+		if _, err := rs.Seek(f.pos, io.SeekStart); err != nil {
+			return 0, &fs.PathError{Op: "seek", Path: f.name, Err: err}
+		}
+
+		f.r = rs
+	}
+
+	pos, err := rs.Seek(offset, whence)
+	if err != nil {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: err}
+	}
+
+	f.pos = pos
+
+	return pos, nil
+}
+
+func (f *file) Close() error {
+	f.close()
+
+	f.r = empty{}
+
+	return nil
+}
+
+func (f *file) close() {
+	if c, ok := f.r.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+type dir struct {
+	*fileInfo
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.fileInfo, nil
+}
+
+func (d *dir) Read(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errIsDir}
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := readDir(d.node)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: err}
+		}
+
+		d.entries = entries
+		d.read = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+
+		return entries, nil
+	} else if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	entries := d.entries[:min(n, len(d.entries))]
+	d.entries = d.entries[len(entries):]
+
+	return entries, nil
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
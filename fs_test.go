@@ -0,0 +1,107 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	root := &node{
+		children: []node{
+			{
+				name: "a.txt",
+				data: []byte("Hello, World"),
+			},
+			{
+				name: "dir",
+				data: []byte("ignored"),
+				children: []node{
+					{
+						name: "b.txt",
+						data: []byte("123"),
+					},
+					{
+						name: "empty",
+					},
+					{
+						name: "sub",
+						children: []node{
+							{
+								name: "c.txt",
+								data: []byte("456"),
+							},
+						},
+					},
+				},
+			},
+			{
+				name: "in/valid",
+				data: []byte("789"),
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+
+	if err := Serialise(&buf, root); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	m, err := OpenMem(buf.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for n, test := range [...]Node{
+		root,
+		OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len())),
+		m,
+	} {
+		fsys := FS(test)
+
+		if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt", "dir/empty", "dir/sub/c.txt"); err != nil {
+			t.Errorf("test %d: %s", n+1, err)
+		}
+
+		if _, err := fs.ReadFile(fsys, "dir"); !errors.Is(err, errIsDir) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, errIsDir, err)
+		}
+
+		if _, err := fs.Stat(fsys, "in/valid"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, fs.ErrNotExist, err)
+		}
+
+		if info, err := fs.Stat(fsys, "dir"); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if node, ok := info.Sys().(Node); !ok {
+			t.Errorf("test %d: expecting Sys to return Node, got %T", n+1, info.Sys())
+		} else if data, _ := readAll(node); data != "ignored" {
+			t.Errorf("test %d: expecting data %q, got %q", n+1, "ignored", data)
+		}
+
+		f, err := fsys.Open("a.txt")
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if _, err := f.(io.Seeker).Seek(7, io.SeekStart); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if data, _ := io.ReadAll(f); string(data) != "World" {
+			t.Errorf("test %d: expecting data %q, got %q", n+1, "World", data)
+		}
+
+		f.Close()
+	}
+}
+
+func readAll(node Node) (string, error) {
+	var buf bytes.Buffer
+
+	_, err := node.WriteTo(&buf)
+
+	return buf.String(), err
+}
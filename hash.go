@@ -0,0 +1,100 @@
+package tree
+
+import (
+	"bytes"
+	"hash"
+
+	"vimagination.zapto.org/byteio"
+)
+
+// Hash computes the Merkle hash of the given Node, using the given hash
+// function.
+//
+// The hash of a Node is the hash of the following:
+//
+//	The hash of the Nodes data.
+//	For each child, in lexical order:
+//		The length of the childs name (stored as a variable-length integer).
+//		The name of the child.
+//		The Merkle hash of the child.
+//
+// As such, any two Nodes with identical data and children will have the same
+// hash.
+//
+// If a Tree or MemTree Node has a stored hash that was produced by the same hash
+// function, as written when serialising with the Hash option set, then that
+// hash will be used instead of computing the hash.
+func Hash(node Node, h func() hash.Hash) ([]byte, error) {
+	return hashNode(node, h, hashID(h))
+}
+
+func hashNode(node Node, h func() hash.Hash, id []byte) ([]byte, error) {
+	hasher := h()
+
+	if storedID, stored, err := storedHash(node); err != nil {
+		return nil, err
+	} else if bytes.Equal(storedID, id) && len(stored) == hasher.Size() {
+		return stored, nil
+	}
+
+	b, err := sortedChildren(node)
+	if err != nil {
+		return nil, err
+	}
+
+	c := make(children, len(b))
+
+	for n, nn := range b {
+		sum, err := hashNode(nn.Node, h, id)
+		if err != nil {
+			return nil, err
+		}
+
+		c[n] = child{name: nn.Name, hash: sum}
+	}
+
+	if _, err := node.WriteTo(hasher); err != nil {
+		return nil, err
+	}
+
+	return merkleHash(h(), hasher.Sum(nil), c), nil
+}
+
+func storedHash(node Node) ([]byte, []byte, error) {
+	switch node := node.(type) {
+	case *Tree:
+		return node.storedHash()
+	case *TreeCloser:
+		return node.storedHash()
+	case *MemTree:
+		return node.hashID, node.hash, nil
+	}
+
+	return nil, nil, nil
+}
+
+// hashID identifies a hash function by the leading bytes of its hash of no
+// data, allowing a stored hash to be matched to the function that produced it.
+func hashID(h func() hash.Hash) []byte {
+	id := make([]byte, hashIDSize)
+
+	copy(id, h().Sum(nil))
+
+	return id
+}
+
+const hashIDSize = 4
+
+func merkleHash(h hash.Hash, dataHash []byte, c children) []byte {
+	w := byteio.StickyLittleEndianWriter{Writer: h}
+
+	w.Write(dataHash)
+
+	for _, child := range c {
+		w.WriteUintX(uint64(len(child.name)))
+		w.WriteString(child.name)
+		w.Write(child.hash)
+	}
+
+	return h.Sum(nil)
+}
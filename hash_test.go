@@ -0,0 +1,78 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	expected, err := Hash(testChild, sha256.New)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var buf, stored bytes.Buffer
+
+	Serialise(&buf, testChild)
+
+	if err := SerialiseWithOptions(&stored, testChild, Options{Hash: sha256.New, Checksums: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	m, _ := OpenMem(buf.Bytes())
+	ms, _ := OpenMem(stored.Bytes())
+	tree := OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	treeStored := OpenAt(bytes.NewReader(stored.Bytes()), int64(stored.Len()))
+
+	for n, test := range [...]Node{m, ms, tree, treeStored} {
+		if h, err := Hash(test, sha256.New); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if !bytes.Equal(h, expected) {
+			t.Errorf("test %d: expecting hash %x, got %x", n+1, expected, h)
+		}
+	}
+
+	if h := m.Hash(); h != nil {
+		t.Errorf("expecting no stored hash, got %x", h)
+	} else if h := ms.Hash(); !bytes.Equal(h, expected) {
+		t.Errorf("expecting stored hash %x, got %x", expected, h)
+	} else if h, err := treeStored.Hash(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !bytes.Equal(h, expected) {
+		t.Errorf("expecting stored hash %x, got %x", expected, h)
+	}
+
+	for name, child := range treeStored.Children() {
+		h, _ := child.(*Tree).Hash()
+		c, _ := Child(testChild, name)
+
+		if e, _ := Hash(c, sha256.New); !bytes.Equal(h, e) {
+			t.Errorf("child %s: expecting stored hash %x, got %x", name, e, h)
+		}
+	}
+
+	other, err := Hash(testChild, sha512.New512_256)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for n, test := range [...]Node{ms, treeStored} {
+		if h, err := Hash(test, sha512.New512_256); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if !bytes.Equal(h, other) {
+			t.Errorf("test %d: expecting hash %x from different hash function, got %x", n+1, other, h)
+		}
+	}
+
+	a, _ := Hash(Branch{{"A", Leaf("B")}}, sha256.New)
+	b, _ := Hash(Branch{{"A", Branch{{"B", Leaf("")}}}}, sha256.New)
+	c, _ := Hash(Branch{{"A", Leaf("B")}}, sha256.New)
+
+	if bytes.Equal(a, b) {
+		t.Errorf("expecting different trees to have different hashes")
+	} else if !bytes.Equal(a, c) {
+		t.Errorf("expecting identical trees to have identical hashes")
+	}
+}
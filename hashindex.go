@@ -0,0 +1,289 @@
+package tree
+
+import (
+	"bytes"
+	"io"
+	"math/bits"
+	"slices"
+
+	"vimagination.zapto.org/byteio"
+)
+
+const (
+	fnvOffset = 2166136261
+	fnvPrime  = 16777619
+)
+
+// hashIndex is an open addressing hash table, using linear probing, that maps
+// child names to their index in the list of children, followed by a table of
+// the offsets of the name and pointer of each child, so that a child can be
+// found without decoding the NameSizes section.
+//
+// Each slot is stored as a little-endian integer of slotWidth bytes, with zero
+// marking an empty slot and any other value being the index of a child plus
+// one. Each offset is stored as a little-endian integer of offsetWidth bytes,
+// and is the distance back from the start of the NameSizes section.
+//
+// The index is read in place, using the io.ReaderAt, so that only the probed
+// slots and offsets are read.
+type hashIndex struct {
+	r                      io.ReaderAt
+	slotWidth, offsetWidth int
+	numChildren, numSlots  int
+	slots, offsets         int64
+}
+
+func nameHash(name string) uint32 {
+	h := uint32(fnvOffset)
+
+	for i := 0; i < len(name); i++ {
+		h ^= uint32(name[i])
+		h *= fnvPrime
+	}
+
+	return h
+}
+
+// uintWidth returns the number of bytes needed to store the given value.
+func uintWidth(v uint64) int {
+	return (bits.Len64(v) + 7) / 8
+}
+
+func numSlots(numChildren int) int {
+	return 1 << bits.Len(uint(2*numChildren-1))
+}
+
+func getUint(data []byte) uint64 {
+	var v uint64
+
+	for n, b := range data {
+		v |= uint64(b) << (8 * n)
+	}
+
+	return v
+}
+
+func putUint(data []byte, v uint64) {
+	for n := range data {
+		data[n] = byte(v >> (8 * n))
+	}
+}
+
+// buildHashIndex creates the hash index record for the given children, whose
+// names and pointers have been written at the offsets described by layout.
+func buildHashIndex(c children, layout []childNameSizes) []byte {
+	var (
+		last        = layout[len(layout)-1]
+		end         = last.ptrStart + int64(last.ptrLength)
+		slotWidth   = uintWidth(uint64(len(c)))
+		offsetWidth = uintWidth(uint64(end - layout[0].nameStart))
+		numSlots    = numSlots(len(c))
+		mask        = uint32(numSlots - 1)
+		buf         bytes.Buffer
+		bw          = byteio.StickyLittleEndianWriter{Writer: &buf}
+	)
+
+	bw.WriteUint8(uint8(slotWidth))
+	bw.WriteUint8(uint8(offsetWidth))
+	bw.WriteUintX(uint64(len(c)))
+
+	slots := make([]byte, numSlots*slotWidth)
+
+	for n, child := range c {
+		slot := int(nameHash(child.name) & mask)
+
+		for getUint(slots[slot*slotWidth:(slot+1)*slotWidth]) != 0 {
+			slot = (slot + 1) & int(mask)
+		}
+
+		putUint(slots[slot*slotWidth:(slot+1)*slotWidth], uint64(n+1))
+	}
+
+	buf.Write(slots)
+
+	offset := make([]byte, offsetWidth)
+
+	for _, child := range layout {
+		putUint(offset, uint64(end-child.nameStart))
+		buf.Write(offset)
+		putUint(offset, uint64(end-child.ptrStart))
+		buf.Write(offset)
+	}
+
+	return buf.Bytes()
+}
+
+// parseHashIndex reads the header of the hash index record stored at the given
+// offset of r.
+func parseHashIndex(r io.ReaderAt, start, length int64) (*hashIndex, error) {
+	header := make([]byte, min(length, 11))
+
+	if _, err := r.ReadAt(header, start); err != nil {
+		return nil, err
+	} else if len(header) < 3 {
+		return nil, ErrInvalidExtension
+	}
+
+	sr := byteio.StickyLittleEndianReader{Reader: bytes.NewReader(header[2:])}
+	count := sr.ReadUintX()
+
+	if sr.Err != nil || count == 0 || count > uint64(length/2) {
+		return nil, ErrInvalidExtension
+	}
+
+	h := &hashIndex{
+		r:           r,
+		slotWidth:   int(header[0]),
+		offsetWidth: int(header[1]),
+		numChildren: int(count),
+		numSlots:    numSlots(int(count)),
+	}
+	h.slots = start + 2 + sr.Count
+	h.offsets = h.slots + int64(h.numSlots*h.slotWidth)
+
+	if h.slotWidth != uintWidth(count) || h.offsetWidth < 1 || h.offsetWidth > 8 || start+length-h.offsets != int64(2*h.numChildren*h.offsetWidth) {
+		return nil, ErrInvalidExtension
+	}
+
+	return h, nil
+}
+
+func (h *hashIndex) get(slot int) (uint64, error) {
+	var buf [8]byte
+
+	if _, err := h.r.ReadAt(buf[:h.slotWidth], h.slots+int64(slot*h.slotWidth)); err != nil {
+		return 0, err
+	}
+
+	return getUint(buf[:h.slotWidth]), nil
+}
+
+// lookup probes the hash table for the given name, calling match with the
+// index of each candidate child until it returns true.
+func (h *hashIndex) lookup(name string, match func(int) (bool, error)) (int, error) {
+	mask := h.numSlots - 1
+	slot := int(nameHash(name)) & mask
+
+	for range h.numSlots {
+		v, err := h.get(slot)
+		if err != nil {
+			return 0, err
+		}
+
+		if v == 0 {
+			break
+		} else if v > uint64(h.numChildren) {
+			return 0, ErrInvalidExtension
+		}
+
+		if ok, err := match(int(v - 1)); err != nil {
+			return 0, err
+		} else if ok {
+			return int(v - 1), nil
+		}
+
+		slot = (slot + 1) & mask
+	}
+
+	return 0, ChildNotFoundError(name)
+}
+
+func (h *hashIndex) readOffsets(from, count int) ([]int64, error) {
+	buf := make([]byte, 2*count*h.offsetWidth)
+
+	if _, err := h.r.ReadAt(buf, h.offsets+int64(2*from*h.offsetWidth)); err != nil {
+		return nil, err
+	}
+
+	offsets := make([]int64, 2*count)
+
+	for n := range offsets {
+		offsets[n] = int64(getUint(buf[n*h.offsetWidth : (n+1)*h.offsetWidth]))
+	}
+
+	return offsets, nil
+}
+
+// childSizes reads the positions of the names and pointers of the children
+// from index from up to, but not including, index to, where end is the start
+// of the NameSizes section.
+func (h *hashIndex) childSizes(from, to int, end int64) ([]childNameSizes, error) {
+	offsets, err := h.readOffsets(from, min(to+1, h.numChildren)-from)
+	if err != nil {
+		return nil, err
+	}
+
+	if to == h.numChildren {
+		first := offsets
+
+		if from > 0 {
+			if first, err = h.readOffsets(0, 1); err != nil {
+				return nil, err
+			}
+		}
+
+		// The last name ends where the pointers start, and the last
+		// pointer ends where the NameSizes section starts.
+		offsets = append(offsets, first[1], 0)
+	}
+
+	nameData := make([]childNameSizes, to-from)
+
+	for n := range nameData {
+		nameStart, ptrStart, nameEnd, ptrEnd := offsets[2*n], offsets[2*n+1], offsets[2*n+2], offsets[2*n+3]
+
+		if nameStart > end || nameEnd > nameStart || ptrStart > nameEnd || ptrStart-ptrEnd < 1 || ptrStart-ptrEnd > 8 {
+			return nil, ErrInvalidExtension
+		}
+
+		nameData[n] = childNameSizes{
+			nameStart:  end - nameStart,
+			nameLength: nameStart - nameEnd,
+			ptrStart:   end - ptrStart,
+			ptrLength:  uint8(ptrStart - ptrEnd),
+		}
+	}
+
+	return nameData, nil
+}
+
+// validate checks that each of the children is stored in exactly one slot, and
+// that the offsets match the given positions of the names and pointers.
+func (h *hashIndex) validate(nameData []childNameSizes, end int64) error {
+	if h.numChildren != len(nameData) {
+		return ErrInvalidExtension
+	}
+
+	slots := make([]byte, h.numSlots*h.slotWidth)
+
+	if _, err := h.r.ReadAt(slots, h.slots); err != nil {
+		return err
+	}
+
+	seen := make([]bool, h.numChildren)
+
+	for slot := range h.numSlots {
+		v := getUint(slots[slot*h.slotWidth : (slot+1)*h.slotWidth])
+
+		if v == 0 {
+			continue
+		} else if v > uint64(h.numChildren) || seen[v-1] {
+			return ErrInvalidExtension
+		}
+
+		seen[v-1] = true
+	}
+
+	if slices.Contains(seen, false) {
+		return ErrInvalidExtension
+	}
+
+	layout, err := h.childSizes(0, h.numChildren, end)
+	if err != nil {
+		return err
+	} else if !slices.Equal(layout, nameData) {
+		return ErrInvalidExtension
+	}
+
+	return nil
+}
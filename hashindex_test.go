@@ -0,0 +1,246 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestHashIndex(t *testing.T) {
+	var wide Branch
+
+	for n := range 1000 {
+		if err := wide.Add("child-"+strconv.Itoa(n), Leaf(strconv.Itoa(n))); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	root := Branch{
+		{Name: "narrow", Node: Branch{{Name: "a", Node: Leaf("b")}}},
+		{Name: "wide", Node: wide},
+	}
+
+	var plain, indexed bytes.Buffer
+
+	if err := Serialise(&plain, root); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := SerialiseWithOptions(&indexed, root, Options{HashIndexThreshold: 100}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if indexed.Len() <= plain.Len() {
+		t.Fatalf("expecting hash index to be written")
+	}
+
+	if err := Verify(bytes.NewReader(indexed.Bytes()), int64(indexed.Len())); err != nil {
+		t.Fatalf("unexpected error verifying: %s", err)
+	}
+
+	r := &countingReaderAt{ReaderAt: bytes.NewReader(indexed.Bytes())}
+	tr := OpenAt(r, int64(indexed.Len()))
+
+	m, err := OpenMem(indexed.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, name := range [...]string{"child-0", "child-500", "child-999"} {
+		treeChild, err := tr.Navigate(slices.Values([]string{"wide", name}))
+		if err != nil {
+			t.Fatalf("Tree: unexpected error: %s", err)
+		}
+
+		memChild, err := m.Navigate(slices.Values([]string{"wide", name}))
+		if err != nil {
+			t.Fatalf("MemTree: unexpected error: %s", err)
+		}
+
+		var tb, mb bytes.Buffer
+
+		treeChild.WriteTo(&tb)
+		memChild.WriteTo(&mb)
+
+		if expected := name[len("child-"):]; tb.String() != expected {
+			t.Errorf("Tree: expecting data %q, got %q", expected, tb.String())
+		} else if mb.String() != expected {
+			t.Errorf("MemTree: expecting data %q, got %q", expected, mb.String())
+		}
+	}
+
+	if r.read > 1024 {
+		t.Errorf("expecting indexed lookups to read only the probed entries, read %d of %d bytes", r.read, indexed.Len())
+	}
+
+	for _, name := range [...]string{"child-1000", "", "narrow"} {
+		if _, err := tr.Navigate(slices.Values([]string{"wide", name})); !errors.Is(err, ChildNotFoundError(name)) {
+			t.Errorf("Tree: expecting ChildNotFoundError for %q, got %v", name, err)
+		}
+
+		if _, err := m.Navigate(slices.Values([]string{"wide", name})); !errors.Is(err, ChildNotFoundError(name)) {
+			t.Errorf("MemTree: expecting ChildNotFoundError for %q, got %v", name, err)
+		}
+	}
+
+	expected := readTree(OpenAt(bytes.NewReader(plain.Bytes()), int64(plain.Len())))
+
+	if read := readTree(tr); !reflect.DeepEqual(read, expected) {
+		t.Errorf("Tree: did not read what we wrote")
+	}
+
+	if read := readTree(m); !reflect.DeepEqual(read, expected) {
+		t.Errorf("MemTree: did not read what we wrote")
+	}
+}
+
+func TestHashIndexLookup(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e"}
+	c := make(children, len(names))
+	layout := make([]childNameSizes, len(names))
+
+	for n, name := range names {
+		c[n].name = name
+		layout[n] = childNameSizes{nameStart: int64(n), nameLength: 1, ptrStart: int64(len(names) + n), ptrLength: 1}
+	}
+
+	record := buildHashIndex(c, layout)
+	end := int64(2 * len(names))
+
+	h, err := parseHashIndex(bytes.NewReader(record), 0, int64(len(record)))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if h.numSlots != 16 {
+		t.Errorf("expecting 16 slots, got %d", h.numSlots)
+	}
+
+	for n, name := range names {
+		if pos, err := h.lookup(name, func(i int) (bool, error) { return names[i] == name, nil }); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if pos != n {
+			t.Errorf("test %d: expecting index %d, got %d", n+1, n, pos)
+		}
+	}
+
+	if nameData, err := h.childSizes(0, len(names), end); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !slices.Equal(nameData, layout) {
+		t.Errorf("expecting child sizes %v, got %v", layout, nameData)
+	}
+
+	if nameData, err := h.childSizes(3, len(names), end); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !slices.Equal(nameData, layout[3:]) {
+		t.Errorf("expecting child sizes %v, got %v", layout[3:], nameData)
+	}
+
+	if err := h.validate(layout, end); err != nil {
+		t.Errorf("unexpected error validating: %s", err)
+	}
+
+	if err := h.validate(layout[:4], end); !errors.Is(err, ErrInvalidExtension) {
+		t.Errorf("expecting ErrInvalidExtension validating against the wrong children, got %v", err)
+	}
+
+	wide := &hashIndex{r: bytes.NewReader(bytes.Repeat([]byte{0xff}, 8)), slotWidth: 8, offsetWidth: 1, numChildren: len(names), numSlots: 1}
+
+	if _, err := wide.lookup("a", func(int) (bool, error) { return true, nil }); !errors.Is(err, ErrInvalidExtension) {
+		t.Errorf("expecting ErrInvalidExtension for slot with top bit set, got %v", err)
+	}
+
+	for n, mutate := range [...]func([]byte) []byte{
+		func(r []byte) []byte { return r[:0] },
+		func(r []byte) []byte { return r[:2] },
+		func(r []byte) []byte { return r[:len(r)-1] },
+		func(r []byte) []byte { return append(r, 0) },
+		func(r []byte) []byte { r[0] = 2; return r },
+		func(r []byte) []byte { r[0] = 8; return r },
+		func(r []byte) []byte { r[1] = 0; return r },
+		func(r []byte) []byte { r[1] = 9; return r },
+		func(r []byte) []byte { r[2] = 0; return r },
+		func(r []byte) []byte { r[2] = 4; return r },
+	} {
+		r := mutate(bytes.Clone(record))
+
+		if _, err := parseHashIndex(bytes.NewReader(r), 0, int64(len(r))); err == nil {
+			t.Errorf("test %d: expecting error", n+1)
+		}
+	}
+}
+
+func TestHashIndexHostile(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := SerialiseWithOptions(&buf, Branch{
+		{Name: "a", Node: Leaf("1")},
+		{Name: "b", Node: Leaf("2")},
+		{Name: "c", Node: Leaf("3")},
+	}, Options{HashIndexThreshold: 1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	record := bytes.Index(buf.Bytes(), []byte{extHashIndex, 17, 1, 1, 3})
+	if record < 0 {
+		t.Fatalf("expecting hash index to be written")
+	}
+
+	slots := record + 5
+	offsets := slots + 8
+
+	for n, test := range [...]struct {
+		Offset   int
+		Data     []byte
+		Child    error
+		MemChild error
+	}{
+		{ // 1
+			Offset: record + 2,
+			Data:   []byte{8},
+			Child:  ErrInvalidExtension,
+		},
+		{ // 2
+			Offset:   slots,
+			Data:     bytes.Repeat([]byte{0xff}, 8),
+			Child:    ErrInvalidExtension,
+			MemChild: ErrInvalidExtension,
+		},
+		{ // 3
+			Offset:   slots,
+			Data:     bytes.Repeat([]byte{1}, 8),
+			Child:    ChildNotFoundError("b"),
+			MemChild: ChildNotFoundError("b"),
+		},
+		{ // 4
+			Offset: offsets,
+			Data:   bytes.Repeat([]byte{0xff}, 6),
+			Child:  ErrInvalidExtension,
+		},
+		{ // 5
+			Offset: offsets,
+			Data:   []byte{buf.Bytes()[offsets+2], buf.Bytes()[offsets+3], buf.Bytes()[offsets], buf.Bytes()[offsets+1]},
+		},
+	} {
+		data := bytes.Clone(buf.Bytes())
+
+		copy(data[test.Offset:], test.Data)
+
+		if _, err := OpenAt(bytes.NewReader(data), int64(len(data))).Child("b"); test.Child != nil && !errors.Is(err, test.Child) {
+			t.Errorf("test %d: Tree: expecting error %v, got %v", n+1, test.Child, err)
+		}
+
+		if m, err := OpenMem(data); err == nil {
+			if _, err := m.Child("b"); test.MemChild != nil && !errors.Is(err, test.MemChild) {
+				t.Errorf("test %d: MemTree: expecting error %v, got %v", n+1, test.MemChild, err)
+			}
+		} else if !errors.Is(err, ErrInvalidExtension) {
+			t.Errorf("test %d: MemTree: expecting ErrInvalidExtension, got %v", n+1, err)
+		}
+
+		if err := Verify(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrInvalidExtension) {
+			t.Errorf("test %d: expecting Verify to report ErrInvalidExtension, got %v", n+1, err)
+		}
+	}
+}
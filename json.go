@@ -0,0 +1,274 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"vimagination.zapto.org/byteio"
+)
+
+const (
+	jsonData   = "$data"
+	jsonBase64 = "$base64"
+	jsonEscape = "$"
+)
+
+// ToJSON writes the given tree to w as JSON.
+//
+// A Node without children is written as a JSON string containing its data,
+// unless the data is not valid UTF-8, in which case it is written as an object
+// with the base64 encoded data stored under the "$base64" key.
+//
+// A Node with children is written as an object, with each child stored under
+// its name. Any data on the Node is stored under the "$data" key, or the
+// "$base64" key when the data is not valid UTF-8. Any child name that begins
+// with a '$' will have an additional '$' added to the front of it.
+//
+// When indent is not empty, each object key will be written on a new line,
+// indented with one copy of indent for each level of nesting.
+func ToJSON(w io.Writer, node Node, indent string) error {
+	jw := jsonWriter{
+		StickyLittleEndianWriter: byteio.StickyLittleEndianWriter{Writer: w},
+		indent:                   indent,
+	}
+
+	jw.writeNode(node, 0)
+
+	return jw.Err
+}
+
+type jsonWriter struct {
+	byteio.StickyLittleEndianWriter
+	indent string
+	buf    bytes.Buffer
+}
+
+func (j *jsonWriter) writeNode(node Node, depth int) {
+	var data bytes.Buffer
+
+	if _, err := node.WriteTo(&data); err != nil {
+		j.Err = err
+
+		return
+	}
+
+	hasChildren := false
+
+	for name, child := range node.Children() {
+		if ce, ok := child.(ChildrenError); ok {
+			j.Err = ce.error
+
+			return
+		}
+
+		if !hasChildren {
+			hasChildren = true
+
+			j.WriteString("{")
+
+			if data.Len() > 0 {
+				j.writeData(data.Bytes(), depth+1)
+				j.WriteString(",")
+			}
+		} else {
+			j.WriteString(",")
+		}
+
+		if strings.HasPrefix(name, jsonEscape) {
+			name = jsonEscape + name
+		}
+
+		j.writeKey(name, depth+1)
+		j.writeNode(child, depth+1)
+
+		if j.Err != nil {
+			return
+		}
+	}
+
+	if hasChildren {
+		j.newLine(depth)
+		j.WriteString("}")
+	} else if utf8.Valid(data.Bytes()) {
+		j.writeString(data.String())
+	} else {
+		j.WriteString("{")
+		j.writeData(data.Bytes(), depth+1)
+		j.newLine(depth)
+		j.WriteString("}")
+	}
+}
+
+func (j *jsonWriter) writeData(data []byte, depth int) {
+	if utf8.Valid(data) {
+		j.writeKey(jsonData, depth)
+		j.writeString(string(data))
+	} else {
+		j.writeKey(jsonBase64, depth)
+		j.writeString(base64.StdEncoding.EncodeToString(data))
+	}
+}
+
+func (j *jsonWriter) writeKey(key string, depth int) {
+	j.newLine(depth)
+	j.writeString(key)
+	j.WriteString(":")
+
+	if j.indent != "" {
+		j.WriteString(" ")
+	}
+}
+
+func (j *jsonWriter) writeString(str string) {
+	j.buf.Reset()
+
+	enc := json.NewEncoder(&j.buf)
+
+	enc.SetEscapeHTML(false)
+	enc.Encode(str)
+
+	j.Write(bytes.TrimSuffix(j.buf.Bytes(), []byte{'\n'}))
+}
+
+func (j *jsonWriter) newLine(depth int) {
+	if j.indent != "" {
+		j.WriteString("\n")
+
+		for range depth {
+			j.WriteString(j.indent)
+		}
+	}
+}
+
+// FromJSON reads a tree, in the format written by ToJSON, from r.
+//
+// Objects without data are returned as Branch Nodes, and strings, and objects
+// with data but no children, are returned as Leaf Nodes. Objects with both
+// data and children are returned as a Branch with additional data.
+//
+// Any JSON value that does not conform to the format will result in
+// ErrInvalidJSON being returned.
+func FromJSON(r io.Reader) (Node, error) {
+	return readJSON(json.NewDecoder(r))
+}
+
+func readJSON(dec *json.Decoder) (Node, error) {
+	tk, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tk := tk.(type) {
+	case string:
+		return Leaf(tk), nil
+	case json.Delim:
+		if tk == '{' {
+			return readJSONObject(dec)
+		}
+	}
+
+	return nil, ErrInvalidJSON
+}
+
+func readJSONObject(dec *json.Decoder) (Node, error) {
+	var (
+		b    Branch
+		data []byte
+	)
+
+	for dec.More() {
+		tk, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		key, _ := tk.(string)
+
+		switch {
+		case key == jsonData || key == jsonBase64:
+			if data, err = readJSONData(dec, key == jsonBase64); err != nil {
+				return nil, err
+			}
+
+			continue
+		case strings.HasPrefix(key, jsonEscape+jsonEscape):
+			key = key[1:]
+		case strings.HasPrefix(key, jsonEscape):
+			return nil, ErrInvalidJSON
+		}
+
+		child, err := readJSON(dec)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := b.Add(key, child); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	if data == nil {
+		return b, nil
+	} else if len(b) == 0 {
+		return Leaf(data), nil
+	}
+
+	return dataBranch{Branch: b, data: data}, nil
+}
+
+func readJSONData(dec *json.Decoder, isBase64 bool) ([]byte, error) {
+	tk, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	str, ok := tk.(string)
+	if !ok {
+		return nil, ErrInvalidJSON
+	}
+
+	if !isBase64 {
+		return []byte(str), nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return nil, ErrInvalidJSON
+	}
+
+	return data, nil
+}
+
+type dataBranch struct {
+	Branch
+	data Leaf
+}
+
+// WriteTo will pass the Nodes data to the given io.Writer as a single
+// byte-slice.
+func (d dataBranch) WriteTo(w io.Writer) (int64, error) {
+	return d.data.WriteTo(w)
+}
+
+// Data returns the Nodes data.
+func (d dataBranch) Data() []byte {
+	return d.data
+}
+
+// DataLen returns the length of the data stored on this Node.
+func (d dataBranch) DataLen() int64 {
+	return int64(len(d.data))
+}
+
+// ErrInvalidJSON is returned from FromJSON when the JSON does not describe a
+// tree.
+var ErrInvalidJSON = errors.New("invalid JSON tree")
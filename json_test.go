@@ -0,0 +1,119 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  node
+		Indent string
+		Output string
+	}{
+		{ // 1
+			Output: `""`,
+		},
+		{ // 2
+			Input:  node{data: []byte("<ABC>")},
+			Output: `"<ABC>"`,
+		},
+		{ // 3
+			Input:  node{data: []byte{0xff, 0}},
+			Output: `{"$base64":"/wA="}`,
+		},
+		{ // 4
+			Input: node{
+				data: []byte("root"),
+				children: []node{
+					{
+						name: "$data",
+						data: []byte("escaped"),
+					},
+					{
+						name: "A",
+						children: []node{
+							{
+								name: "B",
+								data: []byte{0xff},
+							},
+							{
+								name: "C",
+							},
+						},
+					},
+				},
+			},
+			Output: `{"$data":"root","$$data":"escaped","A":{"B":{"$base64":"/w=="},"C":""}}`,
+		},
+		{ // 5
+			Input: node{
+				children: []node{
+					{
+						name: "A",
+						data: []byte("123"),
+						children: []node{
+							{
+								name: "B",
+								data: []byte("456"),
+							},
+						},
+					},
+				},
+			},
+			Indent: "\t",
+			Output: "{\n\t\"A\": {\n\t\t\"$data\": \"123\",\n\t\t\"B\": \"456\"\n\t}\n}",
+		},
+	} {
+		var buf bytes.Buffer
+
+		if err := ToJSON(&buf, &test.Input, test.Indent); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if buf.String() != test.Output {
+			t.Errorf("test %d: expecting output %q, got %q", n+1, test.Output, buf.String())
+		} else if node, err := FromJSON(&buf); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if read := readTree(node); !reflect.DeepEqual(read, test.Input) {
+			t.Errorf("test %d: expecting to read %v, got %v", n+1, test.Input, read)
+		}
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	for n, test := range [...]struct {
+		Input string
+		Error error
+	}{
+		{ // 1
+			Input: `1`,
+			Error: ErrInvalidJSON,
+		},
+		{ // 2
+			Input: `{"A": [1]}`,
+			Error: ErrInvalidJSON,
+		},
+		{ // 3
+			Input: `{"$unknown": ""}`,
+			Error: ErrInvalidJSON,
+		},
+		{ // 4
+			Input: `{"$base64": "!"}`,
+			Error: ErrInvalidJSON,
+		},
+		{ // 5
+			Input: `{"$data": 1}`,
+			Error: ErrInvalidJSON,
+		},
+		{ // 6
+			Input: `{"A": "", "A": ""}`,
+			Error: DuplicateChildError{"A"},
+		},
+	} {
+		if _, err := FromJSON(strings.NewReader(test.Input)); !errors.Is(err, test.Error) && !reflect.DeepEqual(err, test.Error) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Error, err)
+		}
+	}
+}
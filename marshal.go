@@ -0,0 +1,558 @@
+package tree
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	nodeType            = reflect.TypeFor[Node]()
+	textMarshalerType   = reflect.TypeFor[encoding.TextMarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// Marshal converts the given value to a tree.
+//
+// Values are converted as follows:
+//
+//	Node:                     used as-is.
+//	encoding.TextMarshaler:   a Leaf containing the marshalled text.
+//	string, bool, int, uint,
+//	and float types:          a Leaf containing the value as text, as
+//	                          formatted by the strconv package.
+//	[]byte:                   a Leaf containing the bytes.
+//	slice and array types:    a Branch with a child for each element, named
+//	                          by its index.
+//	map types:                a Branch with a child for each element, named
+//	                          by its key, which must be a string, integer, or
+//	                          encoding.TextMarshaler type.
+//	struct types:             a Branch with a child for each exported field.
+//	pointer and interface
+//	types:                    the value pointed to, or an empty Leaf when nil.
+//
+// Struct fields can be customised with a "tree" tag, in the same manner as
+// the "json" tag of the encoding/json package; the name in the tag will be
+// used instead of the field name, a name of "-" will cause the field to be
+// omitted, and the "omitempty" option will cause the field to be omitted when
+// it has its zero value. Fields with nil pointer or interface values are always
+// omitted. The fields of embedded structs without a tag name are treated as
+// fields of the outer struct, except where that struct is already being
+// expanded, such as with a struct that embeds a pointer to its own type, in
+// which case the embedded field is omitted.
+//
+// Any other type will result in an UnsupportedTypeError.
+func Marshal(v any) (Node, error) {
+	return marshal(reflect.ValueOf(v))
+}
+
+func marshal(v reflect.Value) (Node, error) {
+	if !v.IsValid() {
+		return Leaf{}, nil
+	}
+
+	t := v.Type()
+
+	if t.Implements(nodeType) && !isNil(v) {
+		return v.Interface().(Node), nil
+	} else if t.Implements(textMarshalerType) && !isNil(v) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+
+		return Leaf(text), err
+	} else if v.CanAddr() && reflect.PointerTo(t).Implements(textMarshalerType) {
+		text, err := v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+
+		return Leaf(text), err
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return Leaf{}, nil
+		}
+
+		return marshal(v.Elem())
+	case reflect.String:
+		return Leaf(v.String()), nil
+	case reflect.Bool:
+		return Leaf(strconv.AppendBool(nil, v.Bool())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Leaf(strconv.AppendInt(nil, v.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Leaf(strconv.AppendUint(nil, v.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		return Leaf(strconv.AppendFloat(nil, v.Float(), 'g', -1, t.Bits())), nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Leaf(bytes.Clone(v.Bytes())), nil
+		}
+
+		fallthrough
+	case reflect.Array:
+		return marshalSlice(v)
+	case reflect.Map:
+		return marshalMap(v)
+	case reflect.Struct:
+		return marshalStruct(v)
+	}
+
+	return nil, UnsupportedTypeError{Type: t}
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+func marshalSlice(v reflect.Value) (Node, error) {
+	b := make(Branch, 0, v.Len())
+
+	for n := range v.Len() {
+		child, err := marshal(v.Index(n))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := b.Add(strconv.Itoa(n), child); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+func marshalMap(v reflect.Value) (Node, error) {
+	b := make(Branch, 0, v.Len())
+
+	for iter := v.MapRange(); iter.Next(); {
+		name, err := mapKeyName(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		child, err := marshal(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+
+		if err := b.Add(name, child); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+func mapKeyName(k reflect.Value) (string, error) {
+	if k.Type().Implements(textMarshalerType) {
+		text, err := k.Interface().(encoding.TextMarshaler).MarshalText()
+
+		return string(text), err
+	}
+
+	switch k.Kind() {
+	case reflect.String:
+		return k.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+
+	return "", UnsupportedTypeError{Type: k.Type()}
+}
+
+func marshalStruct(v reflect.Value) (Node, error) {
+	var b Branch
+
+	for _, f := range structFields(v.Type()) {
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil || f.omitEmpty && fv.IsZero() {
+			continue
+		} else if k := fv.Kind(); (k == reflect.Pointer || k == reflect.Interface) && fv.IsNil() {
+			continue
+		}
+
+		child, err := marshal(fv)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := b.Add(f.name, child); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+func structFields(t reflect.Type) []structField {
+	return embeddedFields(t, map[reflect.Type]bool{t: true})
+}
+
+// embeddedFields returns the fields of the given struct type, including those
+// of its embedded structs, skipping any embedded struct whose type is already
+// being expanded, as with a struct that embeds a pointer to itself.
+func embeddedFields(t reflect.Type, expanding map[reflect.Type]bool) []structField {
+	var fields []structField
+
+	for n := range t.NumField() {
+		f := t.Field(n)
+		name, opts, _ := strings.Cut(f.Tag.Get("tree"), ",")
+
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct && (f.IsExported() || f.Type.Kind() != reflect.Pointer) {
+				if expanding[ft] {
+					continue
+				}
+
+				expanding[ft] = true
+
+				for _, sf := range embeddedFields(ft, expanding) {
+					sf.index = append([]int{n}, sf.index...)
+					fields = append(fields, sf)
+				}
+
+				delete(expanding, ft)
+
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fields = append(fields, structField{
+			name:      name,
+			index:     []int{n},
+			omitEmpty: slices.Contains(strings.Split(opts, ","), "omitempty"),
+		})
+	}
+
+	return fields
+}
+
+// Unmarshal reads the given tree into the value pointed to by v, using the
+// conversions described by Marshal.
+//
+// The tree is read lazily; for struct types, only the children matching a
+// field are retrieved, and so, when used with a Tree, only the parts of the
+// tree that are required will be read. Fields whose corresponding child does
+// not exist are left unchanged, as are any children that do not correspond to
+// a field.
+//
+// Any value of an interface type that a Node can be assigned to, such as a
+// Node or an empty interface, will be set to the Node itself, allowing that
+// part of the tree to be read at a later time.
+//
+// If v is not a non-nil pointer, ErrInvalidUnmarshal will be returned, and
+// any data that cannot be converted to the required type will result in an
+// UnmarshalError.
+func Unmarshal(node Node, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return ErrInvalidUnmarshal
+	}
+
+	return unmarshal(node, rv.Elem(), nil)
+}
+
+func unmarshal(node Node, v reflect.Value, path []string) error {
+	t := v.Type()
+
+	if t.Kind() == reflect.Interface && reflect.TypeOf(node).AssignableTo(t) {
+		v.Set(reflect.ValueOf(node))
+
+		return nil
+	} else if t.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+
+		return unmarshal(node, v.Elem(), path)
+	} else if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		data, err := readData(node)
+		if err != nil {
+			return err
+		}
+
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(data); err != nil {
+			return &UnmarshalError{Path: path, Type: t, Err: err}
+		}
+
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			data, err := readData(node)
+			if err != nil {
+				return err
+			}
+
+			v.SetBytes(bytes.Clone(data))
+
+			return nil
+		}
+
+		return unmarshalSlice(node, v, path)
+	case reflect.Array:
+		return unmarshalSlice(node, v, path)
+	case reflect.Map:
+		return unmarshalMap(node, v, path)
+	case reflect.Struct:
+		return unmarshalStruct(node, v, path)
+	}
+
+	data, err := readData(node)
+	if err != nil {
+		return err
+	}
+
+	if err := setScalar(v, string(data)); err != nil {
+		return &UnmarshalError{Path: path, Type: t, Err: err}
+	}
+
+	return nil
+}
+
+func readData(node Node) ([]byte, error) {
+	switch d := node.(type) {
+	case *MemTree:
+		return d.readData()
+	case interface{ Data() []byte }:
+		return d.Data(), nil
+	}
+
+	var buf bytes.Buffer
+
+	_, err := node.WriteTo(&buf)
+
+	return buf.Bytes(), err
+}
+
+func setScalar(v reflect.Value, str string) error {
+	t := v.Type()
+
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(str)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(str, 10, t.Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(str, 10, t.Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, t.Bits())
+		if err != nil {
+			return err
+		}
+
+		v.SetFloat(f)
+	default:
+		return UnsupportedTypeError{Type: t}
+	}
+
+	return nil
+}
+
+func unmarshalSlice(node Node, v reflect.Value, path []string) error {
+	isSlice := v.Kind() == reflect.Slice
+
+	if isSlice && v.IsNil() {
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+	} else if isSlice {
+		v.SetLen(0)
+	} else {
+		v.SetZero()
+	}
+
+	count, err := numChildren(node)
+	if err != nil {
+		return err
+	}
+
+	for name, child := range node.Children() {
+		if ce, ok := child.(ChildrenError); ok {
+			return ce.error
+		}
+
+		idx, err := strconv.ParseUint(name, 10, 31)
+		if err != nil {
+			return &UnmarshalError{Path: append(path, name), Type: v.Type(), Err: err}
+		} else if idx >= uint64(count) {
+			return &UnmarshalError{Path: append(path, name), Type: v.Type(), Err: ErrIndexOutOfRange}
+		}
+
+		n := int(idx)
+
+		if isSlice && n >= v.Len() {
+			if n >= v.Cap() {
+				v.Grow(n + 1 - v.Len())
+			}
+
+			v.SetLen(n + 1)
+		} else if n >= v.Len() {
+			continue
+		}
+
+		if err := unmarshal(child, v.Index(n), append(path, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unmarshalMap(node Node, v reflect.Value, path []string) error {
+	t := v.Type()
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+
+	for name, child := range node.Children() {
+		if ce, ok := child.(ChildrenError); ok {
+			return ce.error
+		}
+
+		key := reflect.New(t.Key()).Elem()
+
+		if reflect.PointerTo(t.Key()).Implements(textUnmarshalerType) {
+			if err := key.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(name)); err != nil {
+				return &UnmarshalError{Path: append(path, name), Type: t.Key(), Err: err}
+			}
+		} else if k := t.Key().Kind(); k == reflect.Bool || k == reflect.Float32 || k == reflect.Float64 {
+			return UnsupportedTypeError{Type: t.Key()}
+		} else if err := setScalar(key, name); err != nil {
+			return &UnmarshalError{Path: append(path, name), Type: t.Key(), Err: err}
+		}
+
+		elem := reflect.New(t.Elem()).Elem()
+
+		if err := unmarshal(child, elem, append(path, name)); err != nil {
+			return err
+		}
+
+		v.SetMapIndex(key, elem)
+	}
+
+	return nil
+}
+
+func unmarshalStruct(node Node, v reflect.Value, path []string) error {
+	for _, f := range structFields(v.Type()) {
+		child, err := Child(node, f.name)
+		if errors.As(err, new(ChildNotFoundError)) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err := unmarshal(child, fieldByIndex(v, f.index), append(path, f.name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for n, i := range index {
+		if n > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(i)
+	}
+
+	return v
+}
+
+// UnsupportedTypeError is returned from Marshal and Unmarshal when a value of
+// an unsupported type is encountered.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+// Error implements the error interface.
+func (u UnsupportedTypeError) Error() string {
+	return "unsupported type: " + u.Type.String()
+}
+
+// UnmarshalError is returned from Unmarshal when the data or name of a Node
+// cannot be converted to the required type.
+type UnmarshalError struct {
+	Path []string
+	Type reflect.Type
+	Err  error
+}
+
+// Error implements the error interface.
+func (u *UnmarshalError) Error() string {
+	return "cannot unmarshal " + strings.Join(u.Path, "/") + " into " + u.Type.String() + ": " + u.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (u *UnmarshalError) Unwrap() error {
+	return u.Err
+}
+
+// ErrInvalidUnmarshal is returned from Unmarshal when the given value is not a
+// non-nil pointer.
+var ErrInvalidUnmarshal = errors.New("unmarshal requires a non-nil pointer")
+
+// ErrIndexOutOfRange is returned by Unmarshal when the name of a child Node
+// being unmarshalled into a slice or array is an index not less than the
+// number of children.
+var ErrIndexOutOfRange = errors.New("index out of range")
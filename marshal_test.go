@@ -0,0 +1,240 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type marshalEmbedded struct {
+	Embedded string
+}
+
+type marshalTest struct {
+	marshalEmbedded
+	Name     string `tree:"name"`
+	Count    int    `tree:",omitempty"`
+	Ratio    float64
+	Enabled  bool
+	Size     uint16
+	Tags     []string
+	Data     []byte
+	Lookup   map[string]int
+	ByID     map[int]bool
+	Time     time.Time
+	Next     *marshalTest
+	Ignored  string `tree:"-"`
+	Raw      Node
+	unexport int
+}
+
+func TestMarshal(t *testing.T) {
+	input := marshalTest{
+		marshalEmbedded: marshalEmbedded{Embedded: "yes"},
+		Name:            "root",
+		Ratio:           0.5,
+		Enabled:         true,
+		Size:            65535,
+		Tags:            []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"},
+		Data:            []byte{0, 1, 2},
+		Lookup:          map[string]int{"x": 1, "y": -2},
+		ByID:            map[int]bool{10: true, 2: false},
+		Time:            time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+		Next: &marshalTest{
+			Name:  "child",
+			Count: 3,
+		},
+		Ignored:  "ignored",
+		Raw:      Branch{{Name: "A", Node: Leaf("B")}},
+		unexport: 1,
+	}
+
+	node, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	names := make([]string, 0)
+
+	for name := range node.Children() {
+		names = append(names, name)
+	}
+
+	if expected := []string{"ByID", "Data", "Embedded", "Enabled", "Lookup", "Next", "Ratio", "Raw", "Size", "Tags", "Time", "name"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expecting children %v, got %v", expected, names)
+	}
+
+	var buf bytes.Buffer
+
+	if err := Serialise(&buf, node); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var output marshalTest
+
+	if err := Unmarshal(OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len())), &output); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if read := readTree(output.Raw); !reflect.DeepEqual(read, readTree(input.Raw)) {
+		t.Errorf("expecting Raw Node to match")
+	}
+
+	input.Ignored = ""
+	input.unexport = 0
+	input.Raw = nil
+	input.Next.Tags = []string{}
+	input.Next.Lookup = map[string]int{}
+	input.Next.ByID = map[int]bool{}
+	input.Next.Data = []byte{}
+	output.Raw = nil
+
+	if !reflect.DeepEqual(output, input) {
+		t.Errorf("expecting %v, got %v", input, output)
+	}
+}
+
+type countingReaderAt struct {
+	io.ReaderAt
+	mu   sync.Mutex
+	read int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.ReaderAt.ReadAt(p, off)
+
+	c.mu.Lock()
+	c.read += n
+	c.mu.Unlock()
+
+	return n, err
+}
+
+func TestUnmarshalLazy(t *testing.T) {
+	var buf bytes.Buffer
+
+	Serialise(&buf, Branch{
+		{Name: "Big", Node: Leaf(bytes.Repeat([]byte{'A'}, 1<<20))},
+		{Name: "Small", Node: Leaf("123")},
+	})
+
+	var (
+		r = &countingReaderAt{ReaderAt: bytes.NewReader(buf.Bytes())}
+		v struct {
+			Small int
+		}
+	)
+
+	if err := Unmarshal(OpenAt(r, int64(buf.Len())), &v); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if v.Small != 123 {
+		t.Errorf("expecting value 123, got %d", v.Small)
+	} else if r.read > 1024 {
+		t.Errorf("expecting to read less than 1024 bytes, read %d", r.read)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	var (
+		i int
+		m map[bool]int
+	)
+
+	for n, test := range [...]struct {
+		Input  Node
+		Output any
+		Error  error
+	}{
+		{ // 1
+			Input:  Leaf("1"),
+			Output: i,
+			Error:  ErrInvalidUnmarshal,
+		},
+		{ // 2
+			Input:  Leaf("abc"),
+			Output: &i,
+			Error:  strconv.ErrSyntax,
+		},
+		{ // 3
+			Input:  Branch{{Name: "true", Node: Leaf("1")}},
+			Output: &m,
+			Error:  UnsupportedTypeError{Type: reflect.TypeFor[bool]()},
+		},
+		{ // 4
+			Input:  Leaf("1"),
+			Output: new(chan int),
+			Error:  UnsupportedTypeError{Type: reflect.TypeFor[chan int]()},
+		},
+		{ // 5
+			Input:  Branch{{Name: "2000000000", Node: Leaf("1")}},
+			Output: new([]int),
+			Error:  ErrIndexOutOfRange,
+		},
+		{ // 6
+			Input:  Branch{{Name: "0", Node: Leaf("1")}, {Name: "2", Node: Leaf("2")}},
+			Output: new([2]int),
+			Error:  ErrIndexOutOfRange,
+		},
+	} {
+		if err := Unmarshal(test.Input, test.Output); !errors.Is(err, test.Error) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Error, err)
+		}
+	}
+
+	if _, err := Marshal(make(chan int)); !errors.Is(err, UnsupportedTypeError{Type: reflect.TypeFor[chan int]()}) {
+		t.Errorf("expecting UnsupportedTypeError, got %v", err)
+	}
+}
+
+type marshalRecursive struct {
+	*marshalRecursive
+	Name  string `tree:"name,string,omitempty"`
+	Count int    `tree:",omitempty,string"`
+}
+
+func TestMarshalTagOptions(t *testing.T) {
+	for n, test := range [...]struct {
+		Input    marshalRecursive
+		Children []string
+	}{
+		{ // 1
+			Input: marshalRecursive{},
+		},
+		{ // 2
+			Input:    marshalRecursive{Name: "a", Count: 1},
+			Children: []string{"Count", "name"},
+		},
+		{ // 3
+			Input:    marshalRecursive{marshalRecursive: &marshalRecursive{Name: "b"}, Count: 2},
+			Children: []string{"Count"},
+		},
+	} {
+		node, err := Marshal(test.Input)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		var names []string
+
+		for name := range node.Children() {
+			names = append(names, name)
+		}
+
+		if !reflect.DeepEqual(names, test.Children) {
+			t.Errorf("test %d: expecting children %v, got %v", n+1, test.Children, names)
+		}
+
+		var output marshalRecursive
+
+		if err := Unmarshal(node, &output); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if output.marshalRecursive != nil || output.Name != test.Input.Name || output.Count != test.Input.Count {
+			t.Errorf("test %d: expecting %v, got %v", n+1, test.Input, output)
+		}
+	}
+}
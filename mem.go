@@ -5,17 +5,23 @@ import (
 	"io"
 	"iter"
 	"slices"
-	"unsafe"
 
 	"vimagination.zapto.org/byteio"
 )
 
 // MemTree represents a tree backed by an in-memory byte slice.
 type MemTree struct {
-	tree  []byte
-	data  []byte
-	names []string
-	ptrs  [][]byte
+	tree   []byte
+	data   []byte
+	names  []string
+	ptrs   [][]byte
+	pos    int64
+	hashID []byte
+	hash   []byte
+	meta   *Metadata
+	codec  Codec
+	raw    int64
+	index  *hashIndex
 }
 
 // OpenMem opens a Tree from the given byte slice.
@@ -28,22 +34,52 @@ func OpenMem(data []byte) (*MemTree, error) {
 func OpenMemAt(data []byte, pos int64) (*MemTree, error) {
 	if pos <= 0 {
 		return &MemTree{}, nil
+	} else if pos > int64(len(data)) {
+		return nil, ErrInvalidNode
 	}
 
-	childrenSize, dataSize, sizes, err := readSizes(bytes.NewReader(data), pos)
+	ptr := pos
+
+	sizes, err := readSizes(bytes.NewReader(data), pos)
+	if err != nil {
+		return nil, err
+	}
+
+	pos -= sizes.trailer + sizes.extensions
+
+	ext, err := parseExtensions(bytes.NewReader(data), pos, sizes.extensions)
 	if err != nil {
 		return nil, err
+	} else if err := sizes.checkRequired(ext); err != nil {
+		return nil, err
 	}
 
-	pos -= 1 + sizes
-	dataStart := pos - dataSize
+	dataStart := pos - sizes.data
+	start := dataStart
 	m := &MemTree{
-		tree: data,
-		data: data[dataStart:pos],
+		tree:   data,
+		data:   data[dataStart:pos],
+		pos:    ptr,
+		hashID: ext.hashID,
+		hash:   ext.hash,
+		meta:   ext.metadata,
+		codec:  ext.codec,
+		raw:    ext.rawSize,
+		index:  ext.index,
+	}
+
+	if sizes.children > 0 {
+		if start, err = m.loadChildren(data, dataStart-sizes.children, sizes.children, ext.restart); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.index != nil && m.index.numChildren != len(m.names) {
+		return nil, ErrInvalidExtension
 	}
 
-	if childrenSize > 0 {
-		if err := m.loadChildren(data, dataStart-childrenSize, childrenSize); err != nil {
+	if ext.hasChecksum {
+		if err := ext.verify(bytes.NewReader(data), start, ptr, sizes.trailer); err != nil {
 			return nil, err
 		}
 	}
@@ -51,42 +87,84 @@ func OpenMemAt(data []byte, pos int64) (*MemTree, error) {
 	return m, nil
 }
 
-func (m *MemTree) loadChildren(data []byte, start, length int64) error {
-	nameData, err := readChildNameSizes(bytes.NewReader(data[start:start+length]), length)
+func (m *MemTree) loadChildren(data []byte, start, length int64, restart int) (int64, error) {
+	nameData, err := readChildNameSizes(bytes.NewReader(data[start:start+length]), length, start)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if len(nameData) == 0 {
-		return nil
+		return start, nil
 	}
 
 	lastName := nameData[len(nameData)-1]
 	ptrs := start - lastName.ptrStart - int64(lastName.ptrLength)
 	namesStart := ptrs - lastName.nameStart - lastName.nameLength
-	m.names = make([]string, len(nameData))
 	m.ptrs = make([][]byte, len(nameData))
 
+	if m.names, err = decodeNames(data[namesStart:], nameData, 0, restart); err != nil {
+		return 0, err
+	}
+
 	for n, name := range nameData {
-		m.names[n] = unsafe.String(&data[namesStart+name.nameStart], name.nameLength)
 		m.ptrs[n] = data[ptrs : ptrs+int64(name.ptrLength)]
 		ptrs += int64(name.ptrLength)
+
+		if ptr, _ := readPointer(m.ptrs[n]); ptr > namesStart {
+			return 0, ErrInvalidPointer
+		}
 	}
 
-	return nil
+	return namesStart, nil
+}
+
+func (m *MemTree) pointer() int64 {
+	return m.pos
 }
 
 // WriteTo will pass the Nodes data to the given io.Writer as a single
 // byte-slice.
+//
+// If the data is compressed, it will instead be decompressed to the writer.
 func (m *MemTree) WriteTo(w io.Writer) (int64, error) {
+	if m.codec != nil {
+		r, err := decompress(m.codec, bytes.NewReader(m.data), m.raw)
+		if err != nil {
+			return 0, err
+		}
+
+		defer r.Close()
+
+		return io.Copy(w, r)
+	}
+
 	n, err := w.Write(m.data)
 
 	return int64(n), err
 }
 
 // Data returns the Nodes data.
+//
+// If the data is compressed, it will be decompressed into a new byte slice on
+// each call; should the decompression fail, this will return nil.
 func (m *MemTree) Data() []byte {
-	return m.data
+	data, _ := m.readData()
+
+	return data
+}
+
+func (m *MemTree) readData() ([]byte, error) {
+	if m.codec != nil {
+		var buf bytes.Buffer
+
+		if _, err := m.WriteTo(&buf); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	return m.data, nil
 }
 
 // Child attempts to retrieve a child Node corresponding to the given name.
@@ -94,9 +172,9 @@ func (m *MemTree) Data() []byte {
 // If no child matches the given name, the returned error will be of type
 // ChildNotFoundError.
 func (m *MemTree) Child(name string) (*MemTree, error) {
-	pos, found := slices.BinarySearch(m.names, name)
-	if !found {
-		return nil, ChildNotFoundError(name)
+	pos, err := m.childIndex(name)
+	if err != nil {
+		return nil, err
 	}
 
 	ptr, err := readPointer(m.ptrs[pos])
@@ -107,6 +185,21 @@ func (m *MemTree) Child(name string) (*MemTree, error) {
 	return OpenMemAt(m.tree, ptr)
 }
 
+func (m *MemTree) childIndex(name string) (int, error) {
+	if m.index != nil {
+		return m.index.lookup(name, func(i int) (bool, error) {
+			return m.names[i] == name, nil
+		})
+	}
+
+	pos, found := slices.BinarySearch(m.names, name)
+	if !found {
+		return 0, ChildNotFoundError(name)
+	}
+
+	return pos, nil
+}
+
 func readPointer(ptr byteio.MemLittleEndian) (int64, error) {
 	return readChildPointer(&ptr, uint8(len(ptr))), nil
 }
@@ -146,7 +239,14 @@ func (m *MemTree) ChildNames() iter.Seq[string] {
 }
 
 // DataLen returns the length of the data stored on this Node.
+//
+// For compressed data, this is the uncompressed size stored with the Node,
+// which is checked against the data only when it is read, or by Verify.
 func (m *MemTree) DataLen() int64 {
+	if m.codec != nil {
+		return m.raw
+	}
+
 	return int64(len(m.data))
 }
 
@@ -172,7 +272,27 @@ func (m *MemTree) Navigate(names iter.Seq[string]) (*MemTree, error) {
 	return m, nil
 }
 
+// Hash returns the Merkle hash of the Node, as stored when the tree was
+// serialised with the Hash option set.
+//
+// If no hash was stored, this will return nil.
+func (m *MemTree) Hash() []byte {
+	return m.hash
+}
+
+// Metadata returns the Metadata stored with the Node.
+//
+// If no Metadata was stored, this will return nil.
+func (m *MemTree) Metadata() *Metadata {
+	return m.meta
+}
+
 // SubTree returns a new MemTree created from the data of the current Node.
 func (m *MemTree) SubTree() (*MemTree, error) {
-	return OpenMem(m.data)
+	data, err := m.readData()
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenMem(data)
 }
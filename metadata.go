@@ -0,0 +1,64 @@
+package tree
+
+import (
+	"bytes"
+	"io/fs"
+	"time"
+
+	"vimagination.zapto.org/byteio"
+)
+
+// Metadata contains file metadata that can be stored alongside a Node.
+//
+// When serialising with the Metadata option set, any Node that implements the
+// following method will have the returned Metadata stored with it, as will any
+// Tree or MemTree that was read with stored Metadata:
+//
+//	Metadata() *Metadata
+//
+// The Metadata is not included in the Merkle hash of a Node.
+type Metadata struct {
+	Mode    fs.FileMode
+	ModTime time.Time
+}
+
+func nodeMetadata(node Node) (*Metadata, error) {
+	switch node := node.(type) {
+	case *Tree:
+		return node.Metadata()
+	case *TreeCloser:
+		return node.Metadata()
+	case interface{ Metadata() *Metadata }:
+		return node.Metadata(), nil
+	}
+
+	return nil, nil
+}
+
+func (m *Metadata) appendTo(buf *bytes.Buffer) {
+	w := byteio.StickyLittleEndianWriter{Writer: buf}
+
+	w.WriteUintX(uint64(m.Mode))
+
+	if !m.ModTime.IsZero() {
+		w.WriteUint64(uint64(m.ModTime.Unix()))
+		w.WriteUintX(uint64(m.ModTime.Nanosecond()))
+	}
+}
+
+func parseMetadata(data []byte) (*Metadata, error) {
+	r := byteio.StickyLittleEndianReader{Reader: bytes.NewReader(data)}
+	m := &Metadata{Mode: fs.FileMode(r.ReadUintX())}
+
+	if r.Count < int64(len(data)) {
+		sec := int64(r.ReadUint64())
+		nsec := int64(r.ReadUintX())
+		m.ModTime = time.Unix(sec, nsec)
+	}
+
+	if r.Err != nil || r.Count != int64(len(data)) {
+		return nil, ErrInvalidExtension
+	}
+
+	return m, nil
+}
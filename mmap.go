@@ -0,0 +1,60 @@
+package tree
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+// MemTreeCloser is a MemTree that includes a Close method to release the
+// memory backing the tree.
+type MemTreeCloser struct {
+	MemTree
+	io.Closer
+}
+
+// OpenFileMmap opens a Tree from the given filename by mapping the file into
+// memory, allowing the tree to be used as a MemTree without reading the whole
+// file.
+//
+// On platforms where memory mapping is not supported, the file will instead be
+// read into memory.
+//
+// The returned MemTreeCloser, and all Nodes and data retrieved from it, must
+// not be used after Close has been called.
+func OpenFileMmap(path string) (*MemTreeCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	if size == 0 {
+		return &MemTreeCloser{Closer: io.NopCloser(nil)}, nil
+	} else if size > math.MaxInt {
+		return nil, &os.PathError{Op: "mmap", Path: path, Err: errFileTooLarge}
+	}
+
+	data, c, err := mmap(f, int(size))
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := OpenMem(data)
+	if err != nil {
+		c.Close()
+
+		return nil, err
+	}
+
+	return &MemTreeCloser{MemTree: *m, Closer: c}, nil
+}
+
+var errFileTooLarge = errors.New("file too large")
@@ -0,0 +1,32 @@
+package tree
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+type mapping struct {
+	data []byte
+}
+
+func mmap(f *os.File, size int) ([]byte, io.Closer, error) {
+	data, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: err}
+	}
+
+	return data, &mapping{data: data}, nil
+}
+
+// Close unmaps the file from memory.
+func (m *mapping) Close() error {
+	if m.data == nil {
+		return nil
+	}
+
+	data := m.data
+	m.data = nil
+
+	return syscall.Munmap(data)
+}
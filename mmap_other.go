@@ -0,0 +1,18 @@
+//go:build !linux
+
+package tree
+
+import (
+	"io"
+	"os"
+)
+
+func mmap(f *os.File, size int) ([]byte, io.Closer, error) {
+	data := make([]byte, size)
+
+	if _, err := f.ReadAt(data, 0); err != nil {
+		return nil, nil, err
+	}
+
+	return data, io.NopCloser(nil), nil
+}
@@ -0,0 +1,59 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOpenFileMmap(t *testing.T) {
+	tree := genLargeTree(3)
+	file := filepath.Join(t.TempDir(), "test.tree")
+
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = Serialise(f, &tree); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f.Close()
+
+	m, err := OpenFileMmap(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if read := readTree(&m.MemTree); !reflect.DeepEqual(read, tree) {
+		t.Errorf("did not read what we wrote")
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("unexpected error closing: %s", err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("unexpected error on second close: %s", err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.tree")
+
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if m, err = OpenFileMmap(empty); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if m.NumChildren() != 0 || m.DataLen() != 0 {
+		t.Errorf("expecting empty tree")
+	}
+
+	m.Close()
+
+	if _, err := OpenFileMmap(filepath.Join(t.TempDir(), "missing.tree")); !os.IsNotExist(err) {
+		t.Errorf("expecting not exist error, got %v", err)
+	}
+}
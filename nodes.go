@@ -1,6 +1,7 @@
 package tree
 
 import (
+	"bytes"
 	"io"
 	"iter"
 	"slices"
@@ -270,6 +271,8 @@ func Child(node Node, name string) (Node, error) {
 		return node.Child(name)
 	case Roots:
 		return node.Child(name)
+	case *Overlay:
+		return node.Child(name)
 	}
 
 	for n, child := range node.Children() {
@@ -308,3 +311,48 @@ func Navigate(node Node, names iter.Seq[string]) (Node, error) {
 
 	return node, nil
 }
+
+func dataReader(node Node) (io.Reader, error) {
+	switch node := node.(type) {
+	case *Tree:
+		return node.Reader()
+	case *TreeCloser:
+		return node.Reader()
+	case *MemTree:
+		data, err := node.readData()
+		if err != nil {
+			return nil, err
+		}
+
+		return bytes.NewReader(data), nil
+	case interface{ Data() []byte }:
+		return bytes.NewReader(node.Data()), nil
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		_, err := node.WriteTo(pw)
+
+		pw.CloseWithError(err)
+	}()
+
+	return pr, nil
+}
+
+func dataLen(node Node) (int64, bool, error) {
+	switch node := node.(type) {
+	case *Tree:
+		l, err := node.DataLen()
+
+		return l, true, err
+	case *TreeCloser:
+		l, err := node.DataLen()
+
+		return l, true, err
+	case interface{ DataLen() int64 }:
+		return node.DataLen(), true, nil
+	}
+
+	return 0, false, nil
+}
@@ -0,0 +1,237 @@
+package tree
+
+import (
+	"io"
+	"iter"
+	"maps"
+	"slices"
+)
+
+// Overlay is a mutable Node that records changes on top of an existing Node,
+// such as a Tree or MemTree, presenting the merged result.
+//
+// The underlying Node is never modified.
+//
+// No locking takes place, so all changes should be made before using the
+// Overlay Node.
+type Overlay struct {
+	node    Node
+	data    []byte
+	dataSet bool
+	reuse   bool
+	changes map[string]*Overlay
+}
+
+// NewOverlay creates a new Overlay on top of the given base Node.
+func NewOverlay(base Node) *Overlay {
+	return &Overlay{node: base}
+}
+
+// Set sets the Node at the given path, replacing any existing Node (and its
+// children) at that path.
+//
+// Any missing Nodes along the path will be created as empty Nodes.
+func (o *Overlay) Set(path []string, node Node) error {
+	if len(path) == 0 {
+		*o = Overlay{node: node}
+
+		return nil
+	}
+
+	parent, err := o.navigate(path[:len(path)-1], true)
+	if err != nil {
+		return err
+	}
+
+	parent.setChange(path[len(path)-1], &Overlay{node: node})
+
+	return nil
+}
+
+// SetData replaces the data of the Node at the given path, keeping any of its
+// children.
+//
+// Any missing Nodes along the path will be created as empty Nodes.
+func (o *Overlay) SetData(path []string, data []byte) error {
+	node, err := o.navigate(path, true)
+	if err != nil {
+		return err
+	}
+
+	node.data = data
+	node.dataSet = true
+
+	return nil
+}
+
+// Delete removes the Node, and all of its children, at the given path.
+//
+// Deleting with an empty path will remove all children and data from the
+// Overlay.
+//
+// If the Node does not exist, the returned error will be of type
+// ChildNotFoundError.
+func (o *Overlay) Delete(path []string) error {
+	if len(path) == 0 {
+		*o = Overlay{node: Branch{}}
+
+		return nil
+	}
+
+	if _, err := o.navigate(path, false); err != nil {
+		return err
+	}
+
+	parent, _ := o.navigate(path[:len(path)-1], false)
+
+	parent.setChange(path[len(path)-1], nil)
+
+	return nil
+}
+
+func (o *Overlay) navigate(path []string, create bool) (*Overlay, error) {
+	type step struct {
+		parent *Overlay
+		name   string
+		child  *Overlay
+	}
+
+	var steps []step
+
+	for _, name := range path {
+		child, err := o.child(name, create)
+		if err != nil {
+			return nil, err
+		}
+
+		steps = append(steps, step{parent: o, name: name, child: child})
+		o = child
+	}
+
+	for _, s := range steps {
+		s.parent.setChange(s.name, s.child)
+	}
+
+	return o, nil
+}
+
+func (o *Overlay) child(name string, create bool) (*Overlay, error) {
+	if c, ok := o.changes[name]; ok && c != nil {
+		return c, nil
+	} else if !ok {
+		node, err := Child(o.node, name)
+		if err == nil {
+			return &Overlay{node: node, reuse: o.reuse}, nil
+		} else if _, ok := err.(ChildNotFoundError); !ok {
+			return nil, err
+		}
+	}
+
+	if !create {
+		return nil, ChildNotFoundError(name)
+	}
+
+	return &Overlay{node: Branch{}}, nil
+}
+
+func (o *Overlay) setChange(name string, child *Overlay) {
+	if o.changes == nil {
+		o.changes = make(map[string]*Overlay)
+	}
+
+	o.changes[name] = child
+}
+
+// Children returns an iterator that loops through the merged children of the
+// underlying Node and the recorded changes.
+//
+// If the underlying Node yields its children in lexical order, the merged
+// children will also be yielded in lexical order.
+func (o *Overlay) Children() iter.Seq2[string, Node] {
+	return func(yield func(string, Node) bool) {
+		names := slices.Sorted(maps.Keys(o.changes))
+		done := make(map[string]struct{}, len(names))
+
+		yieldChanges := func(before string, all bool) bool {
+			for len(names) > 0 && (all || names[0] < before) {
+				name := names[0]
+				names = names[1:]
+
+				if _, ok := done[name]; ok {
+					continue
+				}
+
+				done[name] = struct{}{}
+
+				if c := o.changes[name]; c != nil && !yield(name, c) {
+					return false
+				}
+			}
+
+			return true
+		}
+
+		for name, child := range o.node.Children() {
+			if !yieldChanges(name, false) {
+				return
+			}
+
+			if c, ok := o.changes[name]; ok {
+				_, yielded := done[name]
+				done[name] = struct{}{}
+
+				if yielded || c == nil {
+					continue
+				}
+
+				child = c
+			} else if p, ok := child.(pointerNode); ok && o.reuse {
+				child = reused{Node: child, ptr: p.pointer()}
+			}
+
+			if !yield(name, child) {
+				return
+			}
+		}
+
+		yieldChanges("", true)
+	}
+}
+
+// WriteTo writes the Nodes data to the given writer.
+//
+// If the data has been set with SetData, that will be written, otherwise the
+// data of the underlying Node will be written.
+func (o *Overlay) WriteTo(w io.Writer) (int64, error) {
+	if o.dataSet {
+		n, err := w.Write(o.data)
+
+		return int64(n), err
+	}
+
+	return o.node.WriteTo(w)
+}
+
+// Child attempts to retrieve a child Node corresponding to the given name.
+//
+// If no child matches the given name, the returned error will be of type
+// ChildNotFoundError.
+func (o *Overlay) Child(name string) (Node, error) {
+	if c, ok := o.changes[name]; ok {
+		if c == nil {
+			return nil, ChildNotFoundError(name)
+		}
+
+		return c, nil
+	}
+
+	return Child(o.node, name)
+}
+
+// Navigate walks down the Overlay using the names provided by the iterator.
+//
+// Will return the first error encountered, or the final Node if the iterator
+// ends.
+func (o *Overlay) Navigate(names iter.Seq[string]) (Node, error) {
+	return Navigate(o, names)
+}
@@ -0,0 +1,111 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOverlay(t *testing.T) {
+	var buf bytes.Buffer
+
+	Serialise(&buf, testChild)
+
+	m, _ := OpenMem(buf.Bytes())
+
+	for n, base := range [...]Node{
+		OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len())),
+		m,
+		testChild,
+	} {
+		o := NewOverlay(base)
+
+		if err := o.Set([]string{"A1", "B2"}, Leaf("ZYX")); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if err := o.SetData([]string{"A2"}, []byte("FED")); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if err := o.SetData(nil, nil); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if err := o.Delete([]string{"A1", "B1"}); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if err := o.Delete([]string{"A1", "B1"}); !errors.Is(err, ChildNotFoundError("B1")) {
+			t.Fatalf("test %d: expecting ChildNotFoundError(B1), got %v", n+1, err)
+		} else if err := o.Set([]string{"A0", "B1"}, Branch{{"C1", Leaf("123")}}); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		expected := node{
+			children: []node{
+				{
+					name: "A0",
+					children: []node{
+						{
+							name: "B1",
+							children: []node{
+								{
+									name: "C1",
+									data: []byte("123"),
+								},
+							},
+						},
+					},
+				},
+				{
+					name: "A1",
+					data: []byte("123"),
+					children: []node{
+						{
+							name: "B2",
+							data: []byte("ZYX"),
+						},
+						{
+							name: "B3",
+							data: []byte("ABC"),
+						},
+						{
+							name: "B4",
+						},
+					},
+				},
+				{
+					name:     "A2",
+					data:     []byte("FED"),
+					children: testChild.children[1].children,
+				},
+			},
+		}
+
+		if read := readTree(o); !reflect.DeepEqual(read, expected) {
+			t.Errorf("test %d: overlay did not match", n+1)
+		}
+
+		var out bytes.Buffer
+
+		if err := Serialise(&out, o); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if read := readTree(OpenAt(bytes.NewReader(out.Bytes()), int64(out.Len()))); !reflect.DeepEqual(read, expected) {
+			t.Errorf("test %d: serialised overlay did not match", n+1)
+		}
+
+		var data strings.Builder
+
+		if node, err := o.Navigate(slices.Values([]string{"A0", "B1", "C1"})); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if _, err = node.WriteTo(&data); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if data.String() != "123" {
+			t.Errorf("test %d: expecting data %q, got %q", n+1, "123", data.String())
+		}
+
+		if _, err := o.Navigate(slices.Values([]string{"A1", "B1"})); !errors.Is(err, ChildNotFoundError("B1")) {
+			t.Errorf("test %d: expecting ChildNotFoundError(B1), got %v", n+1, err)
+		}
+
+		if _, err := Child(o, "A2"); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		}
+	}
+}
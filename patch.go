@@ -0,0 +1,139 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"iter"
+)
+
+const (
+	patchChildren = "c"
+	patchData     = "d"
+	patchRemove   = "r"
+	patchSet      = "s"
+)
+
+// NewPatch creates a patch tree that describes the changes required to turn
+// tree a into tree b.
+//
+// The patch is itself a tree, which can be serialised and later applied with
+// ApplyPatch. Each Node of the patch may have the following children:
+//
+//	c: a Branch containing the patches for the named child Nodes.
+//	d: a Leaf containing the replacement data for the Node.
+//	r: an empty Leaf, indicating that the Node is to be removed.
+//	s: the replacement Node, including all of its children.
+//
+// The Nodes of tree b are referenced by the patch, and so are not read until
+// the patch is serialised.
+func NewPatch(a, b Node) (Node, error) {
+	patch := NewOverlay(Branch{})
+
+	for path, change := range Diff(a, b) {
+		var (
+			op   string
+			node Node
+		)
+
+		switch {
+		case change.Kind == 0:
+			return nil, change.A.(ChildrenError).error
+		case change.Kind&Added != 0:
+			op, node = patchSet, change.B
+		case change.Kind&Removed != 0:
+			op, node = patchRemove, Leaf{}
+		case change.Kind&DataChanged != 0:
+			op, node = patchData, dataNode{change.B}
+		default:
+			continue
+		}
+
+		if err := patch.Set(patchPath(path, op), node); err != nil {
+			return nil, err
+		}
+	}
+
+	return patch, nil
+}
+
+func patchPath(path []string, op string) []string {
+	pp := make([]string, 0, len(path)*2+1)
+
+	for _, name := range path {
+		pp = append(pp, patchChildren, name)
+	}
+
+	return append(pp, op)
+}
+
+type dataNode struct {
+	Node
+}
+
+func (dataNode) Children() iter.Seq2[string, Node] {
+	return noChildren
+}
+
+// ApplyPatch applies a patch, as created by NewPatch, to the base Node,
+// returning a Node with the changes applied.
+//
+// The base Node is not modified, and the returned Node is ready to be
+// serialised.
+//
+// If the patch contains an unknown operation, the returned error will be
+// ErrInvalidPatch. If the patch attempts to remove a Node that doesn't exist,
+// the returned error will be of type ChildNotFoundError.
+func ApplyPatch(base, patch Node) (Node, error) {
+	o := NewOverlay(base)
+
+	if err := applyPatch(o, nil, patch); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+func applyPatch(o *Overlay, path []string, patch Node) error {
+	for op, node := range patch.Children() {
+		var err error
+
+		switch op {
+		case patchChildren:
+			for name, child := range node.Children() {
+				if ce, ok := child.(ChildrenError); ok {
+					return ce.error
+				}
+
+				if err = applyPatch(o, append(path, name), child); err != nil {
+					break
+				}
+			}
+		case patchData:
+			var buf bytes.Buffer
+
+			if _, err = node.WriteTo(&buf); err == nil {
+				err = o.SetData(path, buf.Bytes())
+			}
+		case patchRemove:
+			err = o.Delete(path)
+		case patchSet:
+			err = o.Set(path, node)
+		default:
+			if ce, ok := node.(ChildrenError); ok {
+				return ce.error
+			}
+
+			return ErrInvalidPatch
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ErrInvalidPatch is returned from ApplyPatch when the patch contains an
+// unknown operation.
+var ErrInvalidPatch = errors.New("invalid patch")
@@ -0,0 +1,58 @@
+package tree
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	b := Branch{
+		{"A1", Branch{
+			{"B1", Leaf("456")},
+			{"B2", Leaf("789")},
+			{"B3", Leaf("ABC")},
+			{"B4", Leaf("")},
+		}},
+		{"A2", Branch{
+			{"B1", Leaf("GHI")},
+			{"B3", Branch{
+				{"C1", Leaf("123")},
+			}},
+		}},
+		{"A3", Leaf("")},
+	}
+
+	var base, buf, out bytes.Buffer
+
+	Serialise(&base, testChild)
+
+	a := OpenAt(bytes.NewReader(base.Bytes()), int64(base.Len()))
+
+	patch, err := NewPatch(a, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if err = Serialise(&buf, patch); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	applied, err := ApplyPatch(a, OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len())))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = Serialise(&out, applied); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if read, expected := readTree(OpenAt(bytes.NewReader(out.Bytes()), int64(out.Len()))), readTree(b); !reflect.DeepEqual(read, expected) {
+		t.Errorf("patched tree did not match")
+	}
+
+	if _, err := ApplyPatch(b, patch); !errors.Is(err, ChildNotFoundError("B2")) {
+		t.Errorf("expecting ChildNotFoundError(B2), got %v", err)
+	}
+
+	if _, err := ApplyPatch(b, Branch{{"x", Leaf("")}}); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("expecting ErrInvalidPatch, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package tree
+
+import (
+	"bytes"
+	"math"
+	"unsafe"
+
+	"vimagination.zapto.org/byteio"
+)
+
+// prefixEncode front-codes the sorted names of the children, returning the
+// encoded entry for each name.
+//
+// Every restart-th name is stored in full; all other names are stored as the
+// length of the prefix shared with the previous name, as a variable-length
+// integer, followed by the remainder of the name.
+func prefixEncode(c children, restart int) ([]string, int) {
+	var (
+		buf     bytes.Buffer
+		bw      = byteio.StickyLittleEndianWriter{Writer: &buf}
+		entries = make([]string, len(c))
+		size    int
+		prev    string
+	)
+
+	for n, child := range c {
+		buf.Reset()
+
+		if n%restart == 0 {
+			buf.WriteString(child.name)
+		} else {
+			shared := sharedPrefix(prev, child.name)
+
+			bw.WriteUintX(uint64(shared))
+			buf.WriteString(child.name[shared:])
+		}
+
+		entries[n] = buf.String()
+		size += buf.Len()
+		prev = child.name
+	}
+
+	return entries, size
+}
+
+func sharedPrefix(a, b string) int {
+	n := min(len(a), len(b))
+
+	for i := range n {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+
+	return n
+}
+
+// decodeNames reads the names of the given children from data, which holds
+// the Names section starting at the absolute offset base.
+//
+// When restart is greater than zero, the names are front-coded, and the first
+// of the given children must be stored at a restart point.
+func decodeNames(data []byte, nameData []childNameSizes, base int64, restart int) ([]string, error) {
+	names := make([]string, len(nameData))
+
+	var prev []byte
+
+	for n, child := range nameData {
+		entry := data[child.nameStart-base : child.nameStart-base+child.nameLength]
+
+		if restart == 0 {
+			names[n] = unsafe.String(unsafe.SliceData(entry), len(entry))
+
+			continue
+		}
+
+		name := entry
+
+		if n%restart != 0 {
+			sr := byteio.StickyLittleEndianReader{Reader: bytes.NewReader(entry)}
+			shared := sr.ReadUintX()
+
+			if sr.Err != nil || shared > uint64(len(prev)) {
+				return nil, ErrInvalidNode
+			}
+
+			name = append(prev[:shared:shared], entry[sr.Count:]...)
+		}
+
+		names[n] = string(name)
+		prev = name
+	}
+
+	return names, nil
+}
+
+func prefixRecord(restart int) []byte {
+	var buf bytes.Buffer
+
+	bw := byteio.StickyLittleEndianWriter{Writer: &buf}
+
+	bw.WriteUintX(uint64(restart))
+
+	return buf.Bytes()
+}
+
+// prefixRecordSize returns the size of the extension record that marks a Node
+// as using front-coded names.
+func prefixRecordSize(restart int) int {
+	return 2 + len(prefixRecord(restart))
+}
+
+func parsePrefixRestart(record []byte) (int, error) {
+	sr := byteio.StickyLittleEndianReader{Reader: bytes.NewReader(record)}
+	restart := sr.ReadUintX()
+
+	if sr.Err != nil || sr.Count != int64(len(record)) || restart == 0 || restart > math.MaxInt {
+		return 0, ErrInvalidExtension
+	}
+
+	return int(restart), nil
+}
@@ -0,0 +1,323 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"vimagination.zapto.org/byteio"
+)
+
+func TestPrefixNames(t *testing.T) {
+	var files Branch
+
+	for n := range 100 {
+		if err := files.Add("some/long/shared/path/file-"+strconv.Itoa(n), Leaf(strconv.Itoa(n))); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	root := Branch{
+		{Name: "files", Node: files},
+		{Name: "single", Node: Branch{{Name: "a", Node: Leaf("b")}}},
+	}
+
+	var plain bytes.Buffer
+
+	if err := Serialise(&plain, root); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := readTree(OpenAt(bytes.NewReader(plain.Bytes()), int64(plain.Len())))
+
+	for n, opts := range [...]Options{
+		{PrefixNames: 1},
+		{PrefixNames: 16},
+		{PrefixNames: 1000},
+		{PrefixNames: 16, HashIndexThreshold: 10},
+		{PrefixNames: 16, Checksums: true, Hash: sha256.New},
+	} {
+		var buf, unprefixed bytes.Buffer
+
+		if err := SerialiseWithOptions(&buf, root, opts); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		restart := opts.PrefixNames
+		opts.PrefixNames = 0
+
+		if err := SerialiseWithOptions(&unprefixed, root, opts); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if restart == 1 && buf.Len() != unprefixed.Len() {
+			t.Errorf("test %d: expecting restart interval of 1 to store names uncompressed", n+1)
+		} else if restart > 1 && buf.Len() >= unprefixed.Len() {
+			t.Errorf("test %d: expecting prefix compressed file to be smaller than %d bytes, got %d", n+1, unprefixed.Len(), buf.Len())
+		}
+
+		if err := Verify(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+			t.Errorf("test %d: unexpected error verifying: %s", n+1, err)
+		}
+
+		tr := OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+
+		m, err := OpenMem(buf.Bytes())
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if read := readTree(tr); !reflect.DeepEqual(read, expected) {
+			t.Errorf("test %d: Tree: did not read what we wrote", n+1)
+		}
+
+		if read := readTree(m); !reflect.DeepEqual(read, expected) {
+			t.Errorf("test %d: MemTree: did not read what we wrote", n+1)
+		}
+
+		for _, name := range [...]string{"some/long/shared/path/file-0", "some/long/shared/path/file-57", "some/long/shared/path/file-99"} {
+			path := slices.Values([]string{"files", name})
+
+			if _, err := OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len())).Navigate(path); err != nil {
+				t.Errorf("test %d: Tree: unexpected error navigating to %q: %s", n+1, name, err)
+			}
+
+			if _, err := m.Navigate(path); err != nil {
+				t.Errorf("test %d: MemTree: unexpected error navigating to %q: %s", n+1, name, err)
+			}
+		}
+
+		for _, name := range [...]string{"some/long/shared/path/file-100", "some/long/shared/path/", ""} {
+			path := slices.Values([]string{"files", name})
+
+			if _, err := OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len())).Navigate(path); !errors.Is(err, ChildNotFoundError(name)) {
+				t.Errorf("test %d: Tree: expecting ChildNotFoundError for %q, got %v", n+1, name, err)
+			}
+
+			if _, err := m.Navigate(path); !errors.Is(err, ChildNotFoundError(name)) {
+				t.Errorf("test %d: MemTree: expecting ChildNotFoundError for %q, got %v", n+1, name, err)
+			}
+		}
+	}
+}
+
+func TestPrefixNamesUnused(t *testing.T) {
+	root := Branch{
+		{Name: "a", Node: Leaf("1")},
+		{Name: "b", Node: Leaf("2")},
+	}
+
+	var plain, prefixed bytes.Buffer
+
+	if err := Serialise(&plain, root); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := SerialiseWithOptions(&prefixed, root, Options{PrefixNames: 16}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !bytes.Equal(plain.Bytes(), prefixed.Bytes()) {
+		t.Errorf("expecting names without shared prefixes to be stored uncompressed")
+	}
+}
+
+func TestPrefixNamesDump(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := SerialiseWithOptions(&buf, Branch{
+		{Name: "prefix-aaaa", Node: Leaf("")},
+		{Name: "prefix-aaab", Node: Leaf("")},
+		{Name: "prefix-b", Node: Leaf("")},
+	}, Options{PrefixNames: 2}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var out bytes.Buffer
+
+	if err := Dump(&out, bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, line := range [...]string{
+		`Name 0: "prefix-aaaa"`,
+		`Name 1: "prefix-aaab" (shared 10)`,
+		`Name 2: "prefix-b"`,
+		`type 0x02 (prefix names)`,
+		`Sizes Length @ 0x20, 1 bytes`,
+		`extended, children, extensions`,
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expecting dump to contain %q, got:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestPrefixNamesExtendedForm(t *testing.T) {
+	root := Branch{
+		{Name: "prefix-aaaa", Node: Leaf("")},
+		{Name: "prefix-aaab", Node: Leaf("")},
+	}
+
+	for n, opts := range [...]Options{
+		{PrefixNames: 2},
+		{Compression: CodecFlate},
+	} {
+		var buf bytes.Buffer
+
+		if err := SerialiseWithOptions(&buf, Branch{{Name: "a", Node: root}, {Name: "b", Node: Leaf(strings.Repeat("data", 10))}}, opts); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		var extended bool
+
+		for _, child := range OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len())).Children() {
+			ptr := child.(*Tree).pos
+			data := buf.Bytes()[:ptr]
+
+			if sizes, err := readSizes(bytes.NewReader(data), ptr); err != nil {
+				t.Fatalf("test %d: unexpected error: %s", n+1, err)
+			} else if !sizes.extended {
+				continue
+			}
+
+			extended = true
+
+			if err := readBaselineSizes(data); err == nil {
+				t.Errorf("test %d: expecting readers that predate extensions to fail", n+1)
+			}
+
+			plain := append(data[:ptr-2:ptr-2], data[ptr-1]|data[ptr-2])
+
+			if _, err := OpenAt(bytes.NewReader(plain), int64(len(plain))).Reader(); !errors.Is(err, ErrInvalidNode) {
+				t.Errorf("test %d: Tree: expecting ErrInvalidNode for required extensions without extended flags, got %v", n+1, err)
+			}
+
+			if _, err := OpenMem(plain); !errors.Is(err, ErrInvalidNode) {
+				t.Errorf("test %d: MemTree: expecting ErrInvalidNode for required extensions without extended flags, got %v", n+1, err)
+			}
+
+			if err := Verify(bytes.NewReader(plain), int64(len(plain))); !errors.Is(err, ErrInvalidNode) {
+				t.Errorf("test %d: Verify: expecting ErrInvalidNode for required extensions without extended flags, got %v", n+1, err)
+			}
+		}
+
+		if !extended {
+			t.Errorf("test %d: expecting node with required extensions to use extended flags", n+1)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := SerialiseWithOptions(&buf, root, Options{Checksums: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data := buf.Bytes()
+	flags := data[len(data)-1]
+	data = append(data[:len(data)-1], flags&0x1f, flags&^0x1f)
+
+	if _, err := OpenMem(data); !errors.Is(err, ErrInvalidNode) {
+		t.Errorf("expecting ErrInvalidNode for extended flags without required extensions, got %v", err)
+	}
+}
+
+// readBaselineSizes reads the Sizes section of the Node at the end of data in
+// the same way as readers that predate the Extensions section.
+func readBaselineSizes(data []byte) error {
+	flags := data[len(data)-1]
+	sizes := int(flags & 0x1f)
+
+	if sizes > len(data)-1 {
+		return io.ErrUnexpectedEOF
+	}
+
+	sr := byteio.StickyLittleEndianReader{Reader: bytes.NewReader(data[len(data)-1-sizes : len(data)-1])}
+
+	if flags&0x40 != 0 {
+		sr.ReadUintX()
+	}
+
+	if flags&0x20 != 0 {
+		sr.ReadUintX()
+	}
+
+	return sr.Err
+}
+
+func TestDecodeNames(t *testing.T) {
+	entries, _ := prefixEncode(children{
+		{name: "abc"},
+		{name: "abd"},
+		{name: "b"},
+	}, 2)
+
+	var (
+		data     []byte
+		nameData []childNameSizes
+	)
+
+	for _, entry := range entries {
+		nameData = append(nameData, childNameSizes{nameStart: int64(len(data)), nameLength: int64(len(entry))})
+		data = append(data, entry...)
+	}
+
+	if names, err := decodeNames(data, nameData, 0, 2); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if expected := []string{"abc", "abd", "b"}; !slices.Equal(names, expected) {
+		t.Errorf("expecting names %q, got %q", expected, names)
+	}
+
+	for n, test := range [...]struct {
+		Data    string
+		Lengths []int64
+		Restart int
+	}{
+		{ // shared longer than previous name
+			Data:    "ab\x03c",
+			Lengths: []int64{2, 2},
+			Restart: 2,
+		},
+		{ // missing shared length
+			Data:    "ab",
+			Lengths: []int64{2, 0},
+			Restart: 2,
+		},
+		{ // invalid varint
+			Data:    "ab\x80",
+			Lengths: []int64{2, 1},
+			Restart: 2,
+		},
+	} {
+		var (
+			nameData []childNameSizes
+			start    int64
+		)
+
+		for _, l := range test.Lengths {
+			nameData = append(nameData, childNameSizes{nameStart: start, nameLength: l})
+			start += l
+		}
+
+		if _, err := decodeNames([]byte(test.Data), nameData, 0, test.Restart); !errors.Is(err, ErrInvalidNode) {
+			t.Errorf("test %d: expecting ErrInvalidNode, got %v", n+1, err)
+		}
+	}
+
+	for n, record := range [...][]byte{
+		{},
+		{0},
+		{1, 0},
+		{0x80},
+	} {
+		if _, err := parsePrefixRestart(record); !errors.Is(err, ErrInvalidExtension) {
+			t.Errorf("test %d: expecting ErrInvalidExtension, got %v", n+1, err)
+		}
+	}
+}
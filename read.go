@@ -3,24 +3,54 @@ package tree
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"io"
 	"iter"
 	"os"
-	"sort"
-	"strings"
+	"runtime"
+	"slices"
 	"sync"
-	"unsafe"
+	"sync/atomic"
+	"weak"
 
 	"vimagination.zapto.org/byteio"
 )
 
 // Tree represents a Node of a tree backed by an io.ReaderAt.
+//
+// A Tree is safe for concurrent use. The layout of the Node and the sizes of
+// its children are each decoded once, on first use, and child Trees are cached
+// so that all callers share the same decoded Nodes. A child Tree holds on to
+// its parent, and cached children are released once no longer referenced, so
+// the cache only grows with the Nodes that are in use.
+//
+// A child is found by name with a binary search that reads only the probed
+// names or, when a Node has a stored hash index (see
+// Options.HashIndexThreshold), by reading only the names in the probed slots.
 type Tree struct {
-	r                         io.ReaderAt
-	children, ptrs, data, ptr int64
+	r      io.ReaderAt
+	pos    int64
+	parent *Tree
+
+	node     atomic.Pointer[treeNode]
+	children atomic.Pointer[treeChildren]
+	nodes    sync.Map
+}
 
-	mu       sync.Mutex
+type treeNode struct {
+	data, ptr, children int64
+	hashID, hash        []byte
+	metadata            *Metadata
+	codec               Codec
+	rawSize             int64
+	restart             int
+	index               *hashIndex
+	nameData            []childNameSizes
+}
+
+type treeChildren struct {
 	nameData []childNameSizes
+	restart  int
 }
 
 // OffsetReaderAt is a wrapper around the io.ReaderAt interface that will shift
@@ -45,7 +75,7 @@ func OpenAt(r io.ReaderAt, pos int64) *Tree {
 		r = nil
 	}
 
-	return &Tree{r: r, ptr: pos, data: -1}
+	return &Tree{r: r, pos: pos}
 }
 
 // TreeCloser is a tree that includes a Close method for an opened file.
@@ -79,7 +109,7 @@ func OpenFile(path string) (*TreeCloser, error) {
 	}
 
 	return &TreeCloser{
-		Tree:   Tree{r: r, ptr: pos, data: -1},
+		Tree:   Tree{r: r, pos: pos},
 		Closer: c,
 	}, nil
 }
@@ -91,6 +121,10 @@ func (t *Tree) WriteTo(w io.Writer) (int64, error) {
 		return 0, err
 	}
 
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
 	return io.Copy(w, r)
 }
 
@@ -103,108 +137,405 @@ func (t *Tree) Child(name string) (*Tree, error) {
 		return nil, ChildNotFoundError(name)
 	}
 
-	if err := t.init(); err != nil {
+	n, err := t.initData()
+	if err != nil {
 		return nil, err
 	}
 
-	if len(t.nameData) == 0 {
-		return nil, ChildNotFoundError(name)
+	var ptr int64
+
+	if n.index != nil {
+		ptr, err = n.lookup(t.r, name)
+	} else {
+		ptr, err = t.search(name)
 	}
 
-	pos, err := t.getChildIndex(name)
 	if err != nil {
 		return nil, err
 	}
 
-	child := t.nameData[pos]
-	sr := byteio.StickyLittleEndianReader{Reader: io.NewSectionReader(t.r, child.ptrStart, int64(child.ptrLength))}
+	return t.child(ptr), nil
+}
 
-	childPtr := readChildPointer(&sr, child.ptrLength)
-	if sr.Err != nil {
-		return nil, sr.Err
+func (t *Tree) search(name string) (int64, error) {
+	c, err := t.init()
+	if err != nil {
+		return 0, err
 	}
 
-	return OpenAt(t.r, childPtr), nil
+	pos, err := c.search(t.r, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return readPointerAt(t.r, c.nameData[pos], c.nameData[0].nameStart)
 }
 
-func (t *Tree) init() error {
-	t.mu.Lock()
-	defer t.mu.Unlock()
+// child returns the cached Tree for the child Node at the given pointer,
+// creating and caching it if it is not in use.
+func (t *Tree) child(ptr int64) *Tree {
+	for {
+		if v, ok := t.nodes.Load(ptr); ok {
+			if c := v.(weak.Pointer[Tree]).Value(); c != nil {
+				return c
+			}
+
+			t.nodes.CompareAndDelete(ptr, v)
+		}
+
+		c := OpenAt(t.r, ptr)
+		c.parent = t
+		wp := weak.Make(c)
+
+		if _, loaded := t.nodes.LoadOrStore(ptr, wp); !loaded {
+			runtime.AddCleanup(c, func(ptr int64) { t.nodes.CompareAndDelete(ptr, wp) }, ptr)
 
-	if err := t.initData(); err != nil {
-		return err
+			return c
+		}
 	}
+}
 
-	return t.initChildren()
+func (t *Tree) pointer() int64 {
+	return t.pos
 }
 
-func (t *Tree) initJustData() error {
-	t.mu.Lock()
-	defer t.mu.Unlock()
+func (t *Tree) init() (*treeChildren, error) {
+	if c := t.children.Load(); c != nil {
+		return c, nil
+	}
+
+	n, err := t.initData()
+	if err != nil {
+		return nil, err
+	}
 
-	return t.initData()
+	nameData := n.nameData
+
+	if nameData == nil {
+		if nameData, _, err = readChildren(t.r, n.data, n.children); err != nil {
+			return nil, err
+		}
+	}
+
+	t.children.CompareAndSwap(nil, &treeChildren{
+		nameData: nameData,
+		restart:  n.restart,
+	})
+
+	return t.children.Load(), nil
 }
 
-func (t *Tree) initData() error {
-	if t.data > -1 {
-		return nil
+func (t *Tree) initData() (*treeNode, error) {
+	if n := t.node.Load(); n != nil {
+		return n, nil
 	}
 
-	childrenSize, dataSize, sizes, err := readSizes(t.r, t.ptr)
+	sizes, err := readSizes(t.r, t.pos)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	t.ptr -= 1 + sizes
-	t.data = t.ptr - dataSize
-	t.children = childrenSize
+	ptr := t.pos - sizes.trailer - sizes.extensions
 
-	return nil
+	ext, err := readExtensions(t.r, ptr, sizes.extensions)
+	if err != nil {
+		return nil, err
+	} else if err := sizes.checkRequired(ext); err != nil {
+		return nil, err
+	}
+
+	n := &treeNode{
+		data:     ptr - sizes.data,
+		ptr:      ptr,
+		children: sizes.children,
+		hashID:   ext.hashID,
+		hash:     ext.hash,
+		metadata: ext.metadata,
+		codec:    ext.codec,
+		rawSize:  ext.rawSize,
+		restart:  ext.restart,
+		index:    ext.index,
+	}
+
+	if ext.hasChecksum {
+		nameData, _, err := readChildren(t.r, n.data, sizes.children)
+		if err != nil {
+			return nil, err
+		}
+
+		start := n.data
+
+		if len(nameData) > 0 {
+			start = nameData[0].nameStart
+		}
+
+		if err := ext.verify(t.r, start, t.pos, sizes.trailer); err != nil {
+			return nil, err
+		}
+
+		n.nameData = nameData
+	}
+
+	t.node.CompareAndSwap(nil, n)
+
+	return t.node.Load(), nil
 }
 
-func readSizes(r io.ReaderAt, pos int64) (int64, int64, int64, error) {
+// nodeSizes contains the sizes of the sections of a Node, as read from the end
+// of the Node.
+type nodeSizes struct {
+	children, data, extensions int64
+
+	// trailer is the combined size of the Sizes section and the flag bytes
+	// that follow it.
+	trailer int64
+
+	// extended is set when the Size Flags have their size bits unset and
+	// are preceded by a Sizes Length byte, which is used for Nodes that
+	// have required extensions.
+	extended bool
+}
+
+func readSizes(r io.ReaderAt, pos int64) (nodeSizes, error) {
+	var ns nodeSizes
+
 	sr := byteio.StickyLittleEndianReader{Reader: io.NewSectionReader(r, pos-1, 1)}
-	sizes := int64(sr.ReadUint8())
-	hasChildren := sizes&0x40 > 0
-	hasData := sizes&0x20 > 0
-	sizes &= 0x1f
+	flags := sr.ReadUint8()
+	sizes := int64(flags & 0x1f)
+	ns.trailer = 1
+
+	if sizes == 0 && flags&0x80 != 0 {
+		sr = byteio.StickyLittleEndianReader{Reader: io.NewSectionReader(r, pos-2, 1)}
+		length := sr.ReadUint8()
+
+		if length&0xe0 != 0 {
+			return ns, ErrInvalidNode
+		}
+
+		sizes = int64(length)
+		ns.trailer = 2
+		ns.extended = true
+	}
+
+	if sr.Err != nil {
+		return ns, sr.Err
+	}
+
+	sr = byteio.StickyLittleEndianReader{Reader: io.NewSectionReader(r, pos-ns.trailer-sizes, sizes)}
+
+	if flags&0x40 != 0 {
+		ns.children = int64(sr.ReadUintX())
+	}
+
+	if flags&0x20 != 0 {
+		ns.data = int64(sr.ReadUintX())
+	}
+
+	if flags&0x80 != 0 {
+		ns.extensions = int64(sr.ReadUintX())
+	}
+
+	if sr.Err != nil {
+		return ns, sr.Err
+	}
+
+	ns.trailer += sizes
+
+	if avail := pos - ns.trailer; sr.Count != sizes || avail < 0 || ns.children < 0 || ns.data < 0 || ns.extensions < 0 || ns.children > avail || ns.data > avail-ns.children || ns.extensions > avail-ns.children-ns.data {
+		return ns, ErrInvalidNode
+	}
+
+	return ns, nil
+}
+
+// checkRequired ensures that a Node is in the extended form if, and only if, it
+// has required extensions, so that readers that do not understand the
+// Extensions section fail to read such a Node instead of misreading it.
+func (ns nodeSizes) checkRequired(ext extensions) error {
+	if required := ext.codec != nil || ext.restart > 0; required != ns.extended {
+		return ErrInvalidNode
+	}
+
+	return nil
+}
+
+// list reads the names and pointers of all of the children.
+func (c *treeChildren) list(r io.ReaderAt) ([]string, []int64, error) {
+	if len(c.nameData) == 0 {
+		return nil, nil, nil
+	}
+
+	namesStart := c.nameData[0].nameStart
+	ptrsStart := c.nameData[0].ptrStart
+	last := c.nameData[len(c.nameData)-1]
+	buf := make([]byte, last.ptrStart+int64(last.ptrLength)-namesStart)
+
+	if _, err := r.ReadAt(buf, namesStart); err != nil {
+		return nil, nil, err
+	}
+
+	names, err := decodeNames(buf[:ptrsStart-namesStart], c.nameData, namesStart, c.restart)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ptrs := make([]int64, len(c.nameData))
+	ptrData := byteio.MemLittleEndian(buf[ptrsStart-namesStart:])
+
+	for i, child := range c.nameData {
+		ptrs[i] = readChildPointer(&ptrData, child.ptrLength)
+
+		if ptrs[i] > namesStart {
+			return nil, nil, ErrInvalidPointer
+		}
+	}
+
+	return names, ptrs, nil
+}
+
+// readNames reads the names of the children from index from up to, but not
+// including, index to.
+//
+// For front-coded names, from must be a restart point.
+func (c *treeChildren) readNames(r io.ReaderAt, from, to int) ([]string, error) {
+	nameData := c.nameData[from:to]
+	start := nameData[0].nameStart
+	last := nameData[len(nameData)-1]
+	buf := make([]byte, last.nameStart+last.nameLength-start)
+
+	if _, err := r.ReadAt(buf, start); err != nil {
+		return nil, err
+	}
+
+	return decodeNames(buf, nameData, start, c.restart)
+}
+
+// search performs a binary search for the given name, reading only the names
+// stored in full at each probe; for front-coded names, only the block of names
+// that would contain the name is then read in full.
+func (c *treeChildren) search(r io.ReaderAt, name string) (int, error) {
+	step := max(c.restart, 1)
+	lo, hi := 0, (len(c.nameData)+step-1)/step
+
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+
+		names, err := c.readNames(r, m*step, m*step+1)
+		if err != nil {
+			return 0, err
+		}
+
+		if names[0] == name {
+			return m * step, nil
+		} else if names[0] < name {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
 
-	sr.Reader = io.NewSectionReader(r, pos-1-sizes, sizes)
+	if step == 1 || lo == 0 {
+		return 0, ChildNotFoundError(name)
+	}
 
-	var childrenSize, dataSize int64
+	start := (lo - 1) * step
 
-	if hasChildren {
-		childrenSize = int64(sr.ReadUintX())
+	names, err := c.readNames(r, start, min(start+step, len(c.nameData)))
+	if err != nil {
+		return 0, err
 	}
 
-	if hasData {
-		dataSize = int64(sr.ReadUintX())
+	if pos, found := slices.BinarySearch(names, name); found {
+		return start + pos, nil
 	}
 
-	return childrenSize, dataSize, sizes, sr.Err
+	return 0, ChildNotFoundError(name)
 }
 
-func (t *Tree) initChildren() error {
-	if t.nameData != nil || t.children == 0 {
-		return nil
+// lookup uses the hash index to find the named child, reading only the probed
+// slots and the names and offsets of the candidate children.
+func (n *treeNode) lookup(r io.ReaderAt, name string) (int64, error) {
+	var (
+		end   = n.data - n.children
+		c     = treeChildren{restart: n.restart}
+		child childNameSizes
+	)
+
+	if _, err := n.index.lookup(name, func(i int) (bool, error) {
+		from := i
+
+		if c.restart > 0 {
+			from -= i % c.restart
+		}
+
+		nameData, err := n.index.childSizes(from, i+1, end)
+		if err != nil {
+			return false, err
+		}
+
+		child = nameData[len(nameData)-1]
+
+		if c.restart == 0 && child.nameLength != int64(len(name)) {
+			return false, nil
+		}
+
+		c.nameData = nameData
+
+		names, err := c.readNames(r, 0, len(nameData))
+		if err != nil {
+			return false, err
+		}
+
+		return names[len(names)-1] == name, nil
+	}); err != nil {
+		return 0, err
 	}
 
-	nameData, err := readChildNameSizes(bufio.NewReader(io.NewSectionReader(t.r, t.data-t.children, t.children)), t.children)
+	first, err := n.index.childSizes(0, 1, end)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	return readPointerAt(r, child, first[0].nameStart)
+}
+
+// readPointerAt reads the pointer of the given child, ensuring that it points
+// to before the start of the Names section of its parent.
+func readPointerAt(r io.ReaderAt, child childNameSizes, namesStart int64) (int64, error) {
+	ptr := make(byteio.MemLittleEndian, child.ptrLength)
+
+	if _, err := r.ReadAt(ptr, child.ptrStart); err != nil {
+		return 0, err
+	}
+
+	childPtr := readChildPointer(&ptr, child.ptrLength)
+	if childPtr > namesStart {
+		return 0, ErrInvalidPointer
+	}
+
+	return childPtr, nil
+}
+
+func readChildren(r io.ReaderAt, end, length int64) ([]childNameSizes, int64, error) {
+	if length == 0 {
+		return nil, 0, nil
+	}
+
+	nameData, err := readChildNameSizes(bufio.NewReader(io.NewSectionReader(r, end-length, length)), length, end-length)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	t.nameData = nameData
 	lastName := nameData[len(nameData)-1]
-	t.ptrs = t.data - t.children - lastName.ptrStart - int64(lastName.ptrLength)
-	namesStart := t.ptrs - lastName.nameStart - lastName.nameLength
+	ptrs := end - length - lastName.ptrStart - int64(lastName.ptrLength)
+	namesStart := ptrs - lastName.nameStart - lastName.nameLength
 
 	for n := range nameData {
 		nameData[n].nameStart += namesStart
-		nameData[n].ptrStart += t.ptrs
+		nameData[n].ptrStart += ptrs
 	}
 
-	return nil
+	return nameData, ptrs, nil
 }
 
 type childNameSizes struct {
@@ -214,7 +545,7 @@ type childNameSizes struct {
 	ptrLength  uint8
 }
 
-func readChildNameSizes(r io.Reader, length int64) ([]childNameSizes, error) {
+func readChildNameSizes(r io.Reader, length, avail int64) ([]childNameSizes, error) {
 	var (
 		nameData      []childNameSizes
 		nextNameStart int64
@@ -235,36 +566,13 @@ func readChildNameSizes(r io.Reader, length int64) ([]childNameSizes, error) {
 		})
 		nextNameStart += l
 		nextPtrStart += int64(p)
-	}
 
-	return nameData, sr.Err
-}
-
-func (t *Tree) getChildIndex(name string) (int64, error) {
-	nameBytes := unsafe.Slice(unsafe.StringData(name), len(name))
-
-	var err error
-
-	pos, found := sort.Find(len(t.nameData), func(i int) int {
-		tName := make([]byte, t.nameData[i].nameLength)
-
-		_, err = io.ReadFull(io.NewSectionReader(t.r, t.nameData[i].nameStart, int64(len(tName))), tName)
-		if err != nil {
-			return 0
+		if nextNameStart > avail-nextPtrStart {
+			return nil, ErrInvalidNode
 		}
-
-		return bytes.Compare(nameBytes, tName)
-	})
-
-	if err != nil {
-		return 0, err
-	}
-
-	if !found {
-		return 0, ChildNotFoundError(name)
 	}
 
-	return int64(pos), nil
+	return nameData, sr.Err
 }
 
 func noChildren(_ func(string, Node) bool) {}
@@ -278,44 +586,26 @@ func (t *Tree) Children() iter.Seq2[string, Node] {
 		return noChildren
 	}
 
-	if err := t.init(); err != nil {
+	c, err := t.init()
+	if err != nil {
 		return func(yield func(string, Node) bool) { yield("", ChildrenError{err}) }
 	}
 
-	if len(t.nameData) == 0 {
+	if len(c.nameData) == 0 {
 		return noChildren
 	}
 
-	return t.iterChildren
-}
-
-func (t *Tree) iterChildren(yield func(string, Node) bool) {
-	var sb strings.Builder
-
-	namesStart := t.nameData[0].nameStart
-	nameReader := io.NewSectionReader(t.r, namesStart, t.ptrs-namesStart)
-	ptrReader := byteio.StickyLittleEndianReader{Reader: io.NewSectionReader(t.r, t.ptrs, t.data-t.ptrs)}
-
-	for _, child := range t.nameData {
-		_, err := io.CopyN(&sb, nameReader, child.nameLength)
-		if err != nil {
-			yield("", ChildrenError{err})
-
-			return
-		}
-
-		ptr := readChildPointer(&ptrReader, child.ptrLength)
-		if ptrReader.Err != nil {
-			yield(sb.String(), ChildrenError{err})
-
-			return
-		}
+	names, ptrs, err := c.list(t.r)
+	if err != nil {
+		return func(yield func(string, Node) bool) { yield("", ChildrenError{err}) }
+	}
 
-		if !yield(sb.String(), OpenAt(t.r, ptr)) {
-			return
+	return func(yield func(string, Node) bool) {
+		for n, name := range names {
+			if !yield(name, t.child(ptrs[n])) {
+				return
+			}
 		}
-
-		sb.Reset()
 	}
 }
 
@@ -378,24 +668,39 @@ func (t *Tree) Reader() (io.Reader, error) {
 		return empty{}, nil
 	}
 
-	if err := t.initJustData(); err != nil {
+	n, err := t.initData()
+	if err != nil {
 		return nil, err
 	}
 
-	return io.NewSectionReader(t.r, t.data, t.ptr-t.data), nil
+	sr := io.NewSectionReader(t.r, n.data, n.ptr-n.data)
+
+	if n.codec != nil {
+		return decompress(n.codec, sr, n.rawSize)
+	}
+
+	return sr, nil
 }
 
 // DataLen returns the length of the data stored on this Node.
+//
+// For compressed data, this is the uncompressed size stored with the Node,
+// which is checked against the data only when it is read, or by Verify.
 func (t *Tree) DataLen() (int64, error) {
 	if t.r == nil {
 		return 0, nil
 	}
 
-	if err := t.initJustData(); err != nil {
+	n, err := t.initData()
+	if err != nil {
 		return 0, err
 	}
 
-	return t.ptr - t.data, nil
+	if n.codec != nil {
+		return n.rawSize, nil
+	}
+
+	return n.ptr - n.data, nil
 }
 
 // NumChildren returns the number of child Nodes that are attached to this Node.
@@ -404,11 +709,12 @@ func (t *Tree) NumChildren() (int, error) {
 		return 0, nil
 	}
 
-	if err := t.init(); err != nil {
+	c, err := t.init()
+	if err != nil {
 		return 0, err
 	}
 
-	return len(t.nameData), nil
+	return len(c.nameData), nil
 }
 
 // Navigate walks down the tree using the names provided by the iterator.
@@ -428,18 +734,70 @@ func (t *Tree) Navigate(names iter.Seq[string]) (*Tree, error) {
 	return t, nil
 }
 
+// Hash returns the Merkle hash of the Node, as stored when the tree was
+// serialised with the Hash option set.
+//
+// If no hash was stored, this will return nil.
+func (t *Tree) Hash() ([]byte, error) {
+	_, hash, err := t.storedHash()
+
+	return hash, err
+}
+
+func (t *Tree) storedHash() ([]byte, []byte, error) {
+	if t.r == nil {
+		return nil, nil, nil
+	}
+
+	n, err := t.initData()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return n.hashID, n.hash, nil
+}
+
+// Metadata returns the Metadata stored with the Node.
+//
+// If no Metadata was stored, this will return nil.
+func (t *Tree) Metadata() (*Metadata, error) {
+	if t.r == nil {
+		return nil, nil
+	}
+
+	n, err := t.initData()
+	if err != nil {
+		return nil, err
+	}
+
+	return n.metadata, nil
+}
+
 // SubTree returns a new Tree created from the data of the current Node without
 // having to read the data into a buffer.
+//
+// If the data of the Node is compressed, it will be decompressed into memory.
 func (t *Tree) SubTree() (*Tree, error) {
 	if t.r == nil {
 		return &Tree{}, nil
 	}
 
-	if err := t.initJustData(); err != nil {
+	n, err := t.initData()
+	if err != nil {
 		return nil, err
 	}
 
-	return OpenAt(t.r, t.ptr), nil
+	if n.codec != nil {
+		var buf bytes.Buffer
+
+		if _, err := t.WriteTo(&buf); err != nil {
+			return nil, err
+		}
+
+		return OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len())), nil
+	}
+
+	return OpenAt(t.r, n.ptr), nil
 }
 
 // ChildrenError is a Node and error type that is returned from the Children
@@ -478,3 +836,13 @@ type ChildNotFoundError string
 func (c ChildNotFoundError) Error() string {
 	return "child not found: " + string(c)
 }
+
+var (
+	// ErrInvalidNode is returned when the sizes of the sections of a Node
+	// do not fit within the data.
+	ErrInvalidNode = errors.New("invalid node")
+
+	// ErrInvalidPointer is returned when the pointer to a child Node does
+	// not point to before its parent.
+	ErrInvalidPointer = errors.New("invalid child pointer")
+)
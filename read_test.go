@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"encoding/base64"
 	"errors"
+	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"slices"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 var (
@@ -272,6 +276,121 @@ Loop:
 	}
 }
 
+func TestTreeConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+
+	Serialise(&buf, testChild)
+
+	r := &countingReaderAt{ReaderAt: bytes.NewReader(buf.Bytes())}
+	root := OpenAt(r, int64(buf.Len()))
+	path := []string{"A2", "B2"}
+	nodes := make([]*Tree, 8)
+
+	var wg sync.WaitGroup
+
+	for n := range nodes {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			node, err := root.Navigate(slices.Values(path))
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			} else if _, err := node.DataLen(); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			nodes[n] = node
+		}()
+	}
+
+	wg.Wait()
+
+	for n, node := range nodes[1:] {
+		if node != nodes[0] {
+			t.Errorf("test %d: expecting shared child node", n+2)
+		}
+	}
+
+	for name, child := range root.Children() {
+		if name == "A2" {
+			if c, _ := root.Child("A2"); c != child {
+				t.Errorf("expecting iterated child to be shared")
+			}
+		}
+	}
+
+	if node, err := root.Navigate(slices.Values(path)); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if node != nodes[0] {
+		t.Errorf("expecting child node in use to be shared")
+	}
+
+	nodes = nil
+
+	for range 100 {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+
+		var cached int
+
+		root.nodes.Range(func(_, _ any) bool {
+			cached++
+
+			return true
+		})
+
+		if cached == 0 {
+			return
+		}
+	}
+
+	t.Errorf("expecting unused child nodes to be released from the cache")
+}
+
+func TestTreeChildReads(t *testing.T) {
+	var wide Branch
+
+	for n := range 1000 {
+		if err := wide.Add("child-"+strconv.Itoa(n), Leaf(strconv.Itoa(n))); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	for n, opts := range [...]Options{
+		{},
+		{PrefixNames: 16},
+	} {
+		var buf bytes.Buffer
+
+		if err := SerialiseWithOptions(&buf, wide, opts); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		r := &countingReaderAt{ReaderAt: bytes.NewReader(buf.Bytes())}
+		tr := OpenAt(r, int64(buf.Len()))
+
+		for _, name := range [...]string{"child-0", "child-500", "child-999"} {
+			if child, err := tr.Child(name); err != nil {
+				t.Errorf("test %d: unexpected error: %s", n+1, err)
+			} else if data, err := child.Reader(); err != nil {
+				t.Errorf("test %d: unexpected error: %s", n+1, err)
+			} else if d, _ := io.ReadAll(data); string(d) != name[len("child-"):] {
+				t.Errorf("test %d: expecting data %q, got %q", n+1, name[len("child-"):], d)
+			}
+		}
+
+		if _, err := tr.Child("child-1000"); !errors.Is(err, ChildNotFoundError("child-1000")) {
+			t.Errorf("test %d: expecting ChildNotFoundError, got %v", n+1, err)
+		}
+
+		if r.read > buf.Len()/4 {
+			t.Errorf("test %d: expecting lookups to read less than a quarter of the file, read %d of %d bytes", n+1, r.read, buf.Len())
+		}
+	}
+}
+
 func genLargeTree(level int) node {
 	var n node
 
@@ -0,0 +1,279 @@
+package tree
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// TarOptions contains the options for converting a tar archive with FromTar.
+type TarOptions struct {
+	// Options sets the format extensions used when serialising the tree.
+	//
+	// When the Metadata option is set, the mode and modification time of
+	// each entry are stored as the Metadata of the corresponding Node.
+	Options
+}
+
+type tarEntry struct {
+	pos      int64
+	hash     []byte
+	meta     *Metadata
+	children map[string]*tarEntry
+}
+
+// FromTar reads a tar archive from r and serialises it as a tree to w.
+//
+// Each regular file in the archive becomes a childless Node containing the
+// contents of the file, and each directory becomes a Node containing its
+// entries. Any directories missing from the archive will be created, and all
+// other entry types, such as links, are ignored. When an archive contains more
+// than one entry for the same path, the last is used.
+//
+// The contents of each file are written to w as they are read, so the archive
+// does not need to be buffered in memory, and the entries in the archive do not
+// need to be in any particular order. Once all of the entries have been read,
+// the directory Nodes are written, finishing with the root Node.
+//
+// As with Serialise, if w implements io.Seeker, it will be used to determine
+// the offset of the pointers in the tree.
+func FromTar(w io.Writer, r io.Reader, opts TarOptions) error {
+	sw, err := newWriter(w, opts.Options)
+	if err != nil {
+		return err
+	}
+
+	root := &tarEntry{children: make(map[string]*tarEntry)}
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		var meta *Metadata
+
+		if opts.Metadata {
+			meta = &Metadata{Mode: hdr.FileInfo().Mode(), ModTime: hdr.ModTime}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			name, dir := root.parent(hdr.Name)
+			if dir == nil {
+				continue
+			}
+
+			pos, hash := writeRecord(sw, nil, readerData{tr}, meta)
+			if sw.Err != nil {
+				return sw.Err
+			}
+
+			dir.children[name] = &tarEntry{pos: pos, hash: hash, meta: meta}
+		case tar.TypeDir:
+			name, dir := root.parent(hdr.Name)
+
+			if dir == nil {
+				root.meta = meta
+			} else {
+				dir.child(name).meta = meta
+			}
+		}
+	}
+
+	root.write(sw)
+
+	return sw.Err
+}
+
+func (t *tarEntry) parent(name string) (string, *tarEntry) {
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		return "", nil
+	}
+
+	dir := t
+	parts := strings.Split(name, "/")
+
+	for _, part := range parts[:len(parts)-1] {
+		dir = dir.child(part)
+	}
+
+	return parts[len(parts)-1], dir
+}
+
+func (t *tarEntry) child(name string) *tarEntry {
+	c, ok := t.children[name]
+	if !ok || c.children == nil {
+		c = &tarEntry{children: make(map[string]*tarEntry)}
+		t.children[name] = c
+	}
+
+	return c
+}
+
+func (t *tarEntry) write(w *writer) {
+	c := make(children, 0, len(t.children))
+
+	for _, name := range slices.Sorted(maps.Keys(t.children)) {
+		entry := t.children[name]
+
+		if entry.children != nil {
+			entry.write(w)
+
+			if w.Err != nil {
+				return
+			}
+		}
+
+		c = append(c, child{name: name, pos: entry.pos, hash: entry.hash})
+	}
+
+	t.pos, t.hash = writeRecord(w, c, readerData{}, t.meta)
+}
+
+// ToTar writes the given tree to w as a tar archive, with the entries in the
+// order given by Flatten.
+//
+// Each Node with children, or with stored Metadata that has a directory mode,
+// is written as a directory, and each other Node is written as a regular file
+// containing the data of the Node. The
+// mode and modification time of each entry are taken from any stored Metadata,
+// with directories defaulting to a mode of 0755 and files to 0644 otherwise.
+//
+// As a tar archive cannot store data on a directory, any Node, other than the
+// root, with both data and children will cause ErrMixedNode to be returned;
+// likewise, any name that is not a valid tar path element, such as those that
+// contain a '/', will cause an InvalidNameError to be returned. The root Node
+// has no entry in the archive, and so any data stored on it will cause
+// ErrRootData to be returned before anything is written.
+//
+// The tar archive is closed, but w is not.
+func ToTar(w io.Writer, node Node) error {
+	if err := checkRootData(node); err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+
+	for p, n := range Flatten(node) {
+		if ce, ok := n.(ChildrenError); ok {
+			return ce.error
+		}
+
+		hdr, err := tarHeader(p, n)
+		if err != nil {
+			return err
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := n.WriteTo(tw); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tw.Close()
+}
+
+func tarHeader(p []string, n Node) (*tar.Header, error) {
+	entry, err := newArchiveEntry(p, n)
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := &tar.Header{
+		Name:     entry.name,
+		Typeflag: tar.TypeReg,
+		Mode:     0o644,
+		Size:     entry.size,
+	}
+
+	if entry.dir {
+		hdr.Typeflag = tar.TypeDir
+		hdr.Mode = 0o755
+	}
+
+	if entry.meta != nil {
+		hdr.Mode = int64(entry.meta.Mode.Perm())
+		hdr.ModTime = entry.meta.ModTime
+	}
+
+	return hdr, nil
+}
+
+func checkRootData(node Node) error {
+	if l, err := nodeDataLen(node); err != nil {
+		return err
+	} else if l > 0 {
+		return ErrRootData
+	}
+
+	return nil
+}
+
+type archiveEntry struct {
+	name string
+	dir  bool
+	size int64
+	meta *Metadata
+}
+
+func newArchiveEntry(p []string, n Node) (*archiveEntry, error) {
+	name := p[len(p)-1]
+
+	if !validName(name) || strings.ContainsRune(name, 0) {
+		return nil, InvalidNameError(name)
+	}
+
+	isDir, err := hasChildren(n)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := nodeDataLen(n)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := nodeMetadata(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta != nil && meta.Mode.IsDir() {
+		isDir = true
+	}
+
+	entry := &archiveEntry{
+		name: strings.Join(p, "/"),
+		dir:  isDir,
+		size: size,
+		meta: meta,
+	}
+
+	if isDir {
+		if size > 0 {
+			return nil, ErrMixedNode
+		}
+
+		entry.name += "/"
+	}
+
+	return entry, nil
+}
+
+// ErrRootData is returned from ToTar and ToZip when the root Node has data,
+// which cannot be stored in an archive.
+var ErrRootData = errors.New("root node has data")
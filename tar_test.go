@@ -0,0 +1,313 @@
+package tree
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFromTar(t *testing.T) {
+	var (
+		archive bytes.Buffer
+		modTime = time.Unix(1234567890, 0)
+	)
+
+	tw := tar.NewWriter(&archive)
+
+	for _, entry := range [...]struct {
+		name, data string
+		typ        byte
+		mode       int64
+	}{
+		{name: "z.txt", data: "last", mode: 0o600},
+		{name: "./dir/", typ: tar.TypeDir, mode: 0o700},
+		{name: "dir/sub/b.txt", data: "123", mode: 0o644},
+		{name: "dir/a.txt", data: "old", mode: 0o644},
+		{name: "dir/link", typ: tar.TypeSymlink, mode: 0o777},
+		{name: "dir/a.txt", data: "new", mode: 0o640},
+		{name: "../escape.txt", data: "456", mode: 0o644},
+	} {
+		hdr := &tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typ,
+			Mode:     entry.mode,
+			ModTime:  modTime,
+			Size:     int64(len(entry.data)),
+		}
+
+		if entry.typ == 0 {
+			hdr.Typeflag = tar.TypeReg
+		} else {
+			hdr.Size = 0
+		}
+
+		if entry.typ == tar.TypeSymlink {
+			hdr.Linkname = "a.txt"
+		}
+
+		tw.WriteHeader(hdr)
+		io.WriteString(tw, entry.data)
+	}
+
+	tw.Close()
+
+	expected := node{
+		children: []node{
+			{
+				name: "dir",
+				children: []node{
+					{
+						name: "a.txt",
+						data: []byte("new"),
+					},
+					{
+						name: "sub",
+						children: []node{
+							{
+								name: "b.txt",
+								data: []byte("123"),
+							},
+						},
+					},
+				},
+			},
+			{
+				name: "escape.txt",
+				data: []byte("456"),
+			},
+			{
+				name: "z.txt",
+				data: []byte("last"),
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+
+	if err := FromTar(&buf, bytes.NewReader(archive.Bytes()), TarOptions{Options: Options{Metadata: true}}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tree := OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+
+	if read := readTree(tree); !reflect.DeepEqual(read, expected) {
+		t.Errorf("expecting %v, got %v", expected, read)
+	}
+
+	for n, test := range [...]struct {
+		Path []string
+		Mode fs.FileMode
+	}{
+		{ // 1
+			Path: []string{"dir"},
+			Mode: fs.ModeDir | 0o700,
+		},
+		{ // 2
+			Path: []string{"dir", "a.txt"},
+			Mode: 0o640,
+		},
+		{ // 3
+			Path: []string{"z.txt"},
+			Mode: 0o600,
+		},
+	} {
+		if child, err := tree.Navigate(slices.Values(test.Path)); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if meta, err := child.Metadata(); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if meta == nil {
+			t.Errorf("test %d: expecting metadata", n+1)
+		} else if meta.Mode != test.Mode {
+			t.Errorf("test %d: expecting mode %s, got %s", n+1, test.Mode, meta.Mode)
+		} else if !meta.ModTime.Equal(modTime) {
+			t.Errorf("test %d: expecting modification time %s, got %s", n+1, modTime, meta.ModTime)
+		}
+	}
+
+	if sub, err := tree.Navigate(slices.Values([]string{"dir", "sub"})); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if meta, _ := sub.Metadata(); meta != nil {
+		t.Errorf("expecting no metadata on created directory, got %v", meta)
+	}
+}
+
+func TestFromTarEmpty(t *testing.T) {
+	var (
+		archive bytes.Buffer
+		modTime = time.Unix(1234567890, 0)
+	)
+
+	tw := tar.NewWriter(&archive)
+
+	tw.WriteHeader(&tar.Header{Name: "empty/", Typeflag: tar.TypeDir, Mode: 0o750, ModTime: modTime})
+	tw.WriteHeader(&tar.Header{Name: "empty.txt", Typeflag: tar.TypeReg, Mode: 0o600, ModTime: modTime})
+	tw.Close()
+
+	var buf bytes.Buffer
+
+	if err := FromTar(&buf, bytes.NewReader(archive.Bytes()), TarOptions{Options: Options{Metadata: true}}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var out bytes.Buffer
+
+	if err := ToTar(&out, OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	type entry struct {
+		Name    string
+		Mode    int64
+		ModTime int64
+	}
+
+	var entries []entry
+
+	tr := tar.NewReader(&out)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		entries = append(entries, entry{Name: hdr.Name, Mode: hdr.Mode, ModTime: hdr.ModTime.Unix()})
+	}
+
+	expected := []entry{
+		{Name: "empty/", Mode: 0o750, ModTime: modTime.Unix()},
+		{Name: "empty.txt", Mode: 0o600, ModTime: modTime.Unix()},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expecting entries %v, got %v", expected, entries)
+	}
+}
+
+func TestFromTarDeterministic(t *testing.T) {
+	var archive bytes.Buffer
+
+	tw := tar.NewWriter(&archive)
+
+	for _, name := range [...]string{"e/1", "d/2", "c/3", "b/4", "a/5", "f/g/6", "f/h/7"} {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: 1})
+		io.WriteString(tw, name[len(name)-1:])
+	}
+
+	tw.Close()
+
+	var first []byte
+
+	for n := range 10 {
+		var buf bytes.Buffer
+
+		if err := FromTar(&buf, bytes.NewReader(archive.Bytes()), TarOptions{}); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if n == 0 {
+			first = buf.Bytes()
+		} else if !bytes.Equal(buf.Bytes(), first) {
+			t.Fatalf("test %d: expecting identical output for identical input", n+1)
+		}
+	}
+}
+
+func TestToTar(t *testing.T) {
+	modTime := time.Unix(1234567890, 0)
+	tree := Branch{
+		{Name: "a", Node: Branch{{Name: "b", Node: Leaf("123")}}},
+		{Name: "c", Node: metaNode{Leaf("456"), &Metadata{Mode: 0o600, ModTime: modTime}}},
+	}
+
+	var buf bytes.Buffer
+
+	if err := ToTar(&buf, tree); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	type entry struct {
+		Name string
+		Type byte
+		Mode int64
+		Data string
+	}
+
+	var entries []entry
+
+	tr := tar.NewReader(&buf)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		data, _ := io.ReadAll(tr)
+
+		entries = append(entries, entry{Name: hdr.Name, Type: hdr.Typeflag, Mode: hdr.Mode, Data: string(data)})
+
+		if hdr.Name == "c" && !hdr.ModTime.Equal(modTime) {
+			t.Errorf("expecting modification time %s, got %s", modTime, hdr.ModTime)
+		}
+	}
+
+	expected := []entry{
+		{Name: "a/", Type: tar.TypeDir, Mode: 0o755},
+		{Name: "a/b", Type: tar.TypeReg, Mode: 0o644, Data: "123"},
+		{Name: "c", Type: tar.TypeReg, Mode: 0o600, Data: "456"},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expecting entries %v, got %v", expected, entries)
+	}
+
+	for n, test := range [...]struct {
+		Input Node
+		Error error
+	}{
+		{ // 1
+			Input: Branch{{Name: "a/b", Node: Leaf("123")}},
+			Error: InvalidNameError("a/b"),
+		},
+		{ // 2
+			Input: Branch{{Name: "a", Node: &node{data: []byte("1"), children: []node{{name: "b"}}}}},
+			Error: ErrMixedNode,
+		},
+		{ // 3
+			Input: &node{data: []byte("1"), children: []node{{name: "b"}}},
+			Error: ErrRootData,
+		},
+		{ // 4
+			Input: Leaf("1"),
+			Error: ErrRootData,
+		},
+	} {
+		var buf bytes.Buffer
+
+		if err := ToTar(&buf, test.Input); !errors.Is(err, test.Error) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Error, err)
+		} else if errors.Is(err, ErrRootData) && buf.Len() != 0 {
+			t.Errorf("test %d: expecting nothing to be written, got %d bytes", n+1, buf.Len())
+		}
+	}
+}
+
+type metaNode struct {
+	Leaf
+	meta *Metadata
+}
+
+func (m metaNode) Metadata() *Metadata {
+	return m.meta
+}
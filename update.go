@@ -0,0 +1,65 @@
+package tree
+
+import "io"
+
+// Updater records a set of changes to an existing tree, allowing only the
+// changed Nodes to be appended to the data the tree was read from.
+//
+// As Node pointers are absolute offsets, any unchanged child of a Tree or
+// MemTree can be referenced by its existing pointer instead of being written
+// again.
+type Updater struct {
+	root Overlay
+}
+
+type pointerNode interface {
+	pointer() int64
+}
+
+type reused struct {
+	Node
+	ptr int64
+}
+
+// NewUpdater creates a new Updater that records changes to the given base Node.
+//
+// The base should be a Tree or MemTree; the unchanged children of any other
+// type of Node will be written in full.
+func NewUpdater(base Node) *Updater {
+	return &Updater{root: Overlay{node: base, reuse: true}}
+}
+
+// Put sets the Node at the given path, replacing any existing Node (and its
+// children) at that path.
+//
+// Any missing Nodes along the path will be created as empty Nodes.
+func (u *Updater) Put(path []string, node Node) error {
+	return u.root.Set(path, node)
+}
+
+// Delete removes the Node, and all of its children, at the given path.
+//
+// If the Node does not exist, the returned error will be of type
+// ChildNotFoundError.
+func (u *Updater) Delete(path []string) error {
+	return u.root.Delete(path)
+}
+
+// Append writes the changed Nodes to the given writer, returning the pointer to
+// the new root Node.
+//
+// The writer must be positioned at the end of the data that the base tree was
+// read from, either by implementing io.Seeker or by being wrapped with an
+// OffsetWriter, so that the pointers to the unchanged Nodes remain valid.
+func (u *Updater) Append(w io.Writer) (int64, error) {
+	return u.AppendWithOptions(w, Options{})
+}
+
+// AppendWithOptions writes the changed Nodes to the given writer, as with
+// Append, using the format extensions enabled in the given Options.
+//
+// The Options only apply to the Nodes that are written; to keep the whole tree
+// consistent, they should match the Options used to serialise the base tree.
+func (u *Updater) AppendWithOptions(w io.Writer, opts Options) (int64, error) {
+	return serialise(w, &u.root, opts)
+}
@@ -0,0 +1,202 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUpdater(t *testing.T) {
+	var buf bytes.Buffer
+
+	Serialise(&buf, testChild)
+
+	size := int64(buf.Len())
+	base := OpenAt(bytes.NewReader(buf.Bytes()), size)
+	u := NewUpdater(base)
+
+	if err := u.Put([]string{"A2", "B3"}, Leaf("XYZ")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if err := u.Put([]string{"A3", "B1", "C1"}, Leaf("123")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if err := u.Delete([]string{"A2", "B1"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if err := u.Delete([]string{"A2", "B9"}); !errors.Is(err, ChildNotFoundError("B9")) {
+		t.Fatalf("expecting ChildNotFoundError(B9), got %v", err)
+	} else if err := u.Delete([]string{"A4", "B1"}); !errors.Is(err, ChildNotFoundError("A4")) {
+		t.Fatalf("expecting ChildNotFoundError(A4), got %v", err)
+	}
+
+	ptr, err := u.Append(&OffsetWriter{Writer: &buf, Offset: size})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if ptr != int64(buf.Len()) {
+		t.Fatalf("expecting root pointer %d, got %d", buf.Len(), ptr)
+	}
+
+	expected := node{
+		children: []node{
+			testChild.children[0],
+			{
+				name: "A2",
+				data: []byte("DEF"),
+				children: []node{
+					{
+						name: "B2",
+						data: []byte("JKL"),
+					},
+					{
+						name: "B3",
+						data: []byte("XYZ"),
+					},
+				},
+			},
+			{
+				name: "A3",
+				children: []node{
+					{
+						name: "B1",
+						children: []node{
+							{
+								name: "C1",
+								data: []byte("123"),
+							},
+						},
+					},
+				},
+			},
+		},
+		data: []byte("MNOP"),
+	}
+
+	if read := readTree(OpenAt(bytes.NewReader(buf.Bytes()), ptr)); !reflect.DeepEqual(read, expected) {
+		t.Errorf("no match")
+	}
+
+	if read := readTree(OpenAt(bytes.NewReader(buf.Bytes()), size)); !reflect.DeepEqual(read, *testChild) {
+		t.Errorf("original tree modified")
+	}
+
+	var full bytes.Buffer
+
+	Serialise(&full, &expected)
+
+	if appended := int64(buf.Len()) - size; appended >= int64(full.Len()) {
+		t.Errorf("expecting fewer than %d bytes to be appended, got %d", full.Len(), appended)
+	}
+}
+
+func TestUpdaterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	Serialise(f, testChild)
+	f.Close()
+
+	for n, update := range [...]func(*Updater) error{
+		func(u *Updater) error {
+			return u.Put([]string{"A1", "B5"}, Leaf("GHI"))
+		},
+		func(u *Updater) error {
+			return u.Delete([]string{"A1", "B5"})
+		},
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		m, err := OpenMem(data)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		u := NewUpdater(m)
+
+		if err := update(u); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if _, err := u.Append(f); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		f.Close()
+	}
+
+	tree, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	defer tree.Close()
+
+	if read := readTree(tree); !reflect.DeepEqual(read, *testChild) {
+		t.Errorf("no match")
+	}
+}
+
+func TestUpdaterOptions(t *testing.T) {
+	var buf bytes.Buffer
+
+	opts := Options{Checksums: true, Hash: sha256.New}
+
+	if err := SerialiseWithOptions(&buf, testChild, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	size := int64(buf.Len())
+	u := NewUpdater(OpenAt(bytes.NewReader(buf.Bytes()), size))
+
+	if err := u.Put([]string{"A2", "B3"}, Leaf("XYZ")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ptr, err := u.AppendWithOptions(&OffsetWriter{Writer: &buf, Offset: size}, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := Verify(bytes.NewReader(buf.Bytes()), ptr); err != nil {
+		t.Errorf("unexpected error verifying: %s", err)
+	}
+
+	updated := OpenAt(bytes.NewReader(buf.Bytes()), ptr)
+
+	var plain bytes.Buffer
+
+	if err := Serialise(&plain, updated); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if expected, err := Hash(OpenAt(bytes.NewReader(plain.Bytes()), int64(plain.Len())), sha256.New); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if stored, err := updated.Hash(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if !bytes.Equal(stored, expected) {
+		t.Errorf("expecting stored hash %x, got %x", expected, stored)
+	}
+
+	data := bytes.Clone(buf.Bytes())
+	data[bytes.LastIndex(data, []byte("XYZ"))] = 'x'
+
+	if err := Verify(bytes.NewReader(data), ptr); !errors.As(err, new(ChecksumError)) {
+		t.Errorf("expecting ChecksumError for corrupted appended node, got %v", err)
+	}
+}
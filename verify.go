@@ -0,0 +1,274 @@
+package tree
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"vimagination.zapto.org/byteio"
+)
+
+// Verify checks the structure of the tree stored in the given io.ReaderAt,
+// where size is the length of the data, or the pointer to the root Node.
+//
+// Every Node reachable from the root is checked to ensure that its sizes fit
+// within the data, that its extensions are valid and its checksum, if any,
+// matches, that compressed data decompresses to its stored size, that its
+// child names are strictly sorted, that each child pointer points to before
+// the start of its parent, and that no two Nodes overlap.
+// As all child pointers must point backwards, a tree that passes verification
+// cannot contain any cycles.
+//
+// Any problems found are returned as a VerifyErrors list.
+func Verify(r io.ReaderAt, size int64) error {
+	v := verifier{
+		r:    r,
+		seen: make(map[int64]struct{}),
+	}
+
+	v.push(size)
+
+	for len(v.pending) > 0 {
+		ptr := v.pending[0]
+		v.pending = v.pending[1:]
+
+		v.verifyNode(ptr)
+	}
+
+	v.verifyOverlaps()
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+
+	slices.SortStableFunc(v.errs, func(a, b VerifyError) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+
+	return v.errs
+}
+
+type nodeRange struct {
+	start, end int64
+}
+
+type verifier struct {
+	r       io.ReaderAt
+	pending []int64
+	seen    map[int64]struct{}
+	nodes   []nodeRange
+	errs    VerifyErrors
+}
+
+func (v *verifier) push(ptr int64) {
+	if ptr == 0 {
+		return
+	}
+
+	if _, ok := v.seen[ptr]; !ok {
+		v.seen[ptr] = struct{}{}
+		v.pending = append(v.pending, ptr)
+	}
+}
+
+func (v *verifier) add(offset int64, err error) {
+	v.errs = append(v.errs, VerifyError{Offset: offset, Err: err})
+}
+
+func (v *verifier) verifyNode(ptr int64) {
+	sizes, err := readSizes(v.r, ptr)
+	if err != nil {
+		v.add(ptr-1, err)
+
+		return
+	}
+
+	extStart := ptr - sizes.trailer - sizes.extensions
+
+	ext, err := readExtensions(v.r, extStart, sizes.extensions)
+	if err != nil {
+		v.add(extStart, err)
+
+		return
+	} else if err := sizes.checkRequired(ext); err != nil {
+		v.add(ptr-1, err)
+
+		return
+	}
+
+	dataStart := extStart - sizes.data
+
+	nameData, ptrs, err := readChildren(v.r, dataStart, sizes.children)
+	if err != nil {
+		v.add(dataStart-sizes.children, err)
+
+		return
+	}
+
+	start := dataStart
+
+	if len(nameData) > 0 {
+		start = nameData[0].nameStart
+
+		if err := v.verifyChildren(nameData, ext.restart, ext.index, start, ptrs, dataStart-sizes.children); err != nil {
+			v.add(start, err)
+
+			return
+		}
+	} else if ext.index != nil {
+		v.add(extStart, ErrInvalidExtension)
+	}
+
+	if ext.codec != nil {
+		if err := verifyData(ext, io.NewSectionReader(v.r, dataStart, sizes.data)); err != nil {
+			v.add(dataStart, err)
+		}
+	}
+
+	if ext.hasChecksum {
+		if err := ext.verify(v.r, start, ptr, sizes.trailer); err != nil {
+			v.add(ext.checksumStart, err)
+		}
+	}
+
+	v.nodes = append(v.nodes, nodeRange{start: start, end: ptr})
+}
+
+func (v *verifier) verifyChildren(nameData []childNameSizes, restart int, index *hashIndex, start, ptrs, end int64) error {
+	data := make([]byte, ptrs-start)
+
+	if _, err := v.r.ReadAt(data, start); err != nil {
+		return err
+	}
+
+	names, err := decodeNames(data, nameData, start, restart)
+	if err != nil {
+		return err
+	}
+
+	if index != nil {
+		if err := verifyIndex(index, names, nameData, end); err != nil {
+			return err
+		}
+	}
+
+	pointers := make(byteio.MemLittleEndian, end-ptrs)
+
+	if _, err := v.r.ReadAt(pointers, ptrs); err != nil {
+		return err
+	}
+
+	for n, child := range nameData {
+		if n > 0 && names[n-1] >= names[n] {
+			v.add(child.nameStart, ErrUnsortedNames)
+		}
+
+		if ptr := readChildPointer(&pointers, child.ptrLength); ptr > start {
+			v.add(child.ptrStart, ErrInvalidPointer)
+		} else {
+			v.push(ptr)
+		}
+	}
+
+	return nil
+}
+
+func verifyData(ext extensions, r io.Reader) error {
+	d, err := decompress(ext.codec, r, ext.rawSize)
+	if err != nil {
+		return err
+	}
+
+	defer d.Close()
+
+	_, err = io.Copy(io.Discard, d)
+
+	return err
+}
+
+func verifyIndex(index *hashIndex, names []string, nameData []childNameSizes, end int64) error {
+	if err := index.validate(nameData, end); err != nil {
+		return err
+	}
+
+	for n, name := range names {
+		if pos, err := index.lookup(name, func(i int) (bool, error) {
+			return names[i] == name, nil
+		}); err != nil || pos != n {
+			return ErrInvalidExtension
+		}
+	}
+
+	return nil
+}
+
+func (v *verifier) verifyOverlaps() {
+	slices.SortFunc(v.nodes, func(a, b nodeRange) int {
+		return cmp.Compare(a.start, b.start)
+	})
+
+	for n := 1; n < len(v.nodes); n++ {
+		if v.nodes[n].start < v.nodes[n-1].end {
+			v.add(v.nodes[n].start, ErrOverlappingNodes)
+		}
+	}
+}
+
+// VerifyError describes a single problem found by Verify, along with the
+// offset in the data at which it was found.
+type VerifyError struct {
+	Offset int64
+	Err    error
+}
+
+// Error implements the error interface.
+func (v VerifyError) Error() string {
+	return fmt.Sprintf("offset %d: %s", v.Offset, v.Err)
+}
+
+// Unwrap returns the underlying error.
+func (v VerifyError) Unwrap() error {
+	return v.Err
+}
+
+// VerifyErrors is the list of problems found by Verify, ordered by offset.
+type VerifyErrors []VerifyError
+
+// Error implements the error interface.
+func (v VerifyErrors) Error() string {
+	var sb strings.Builder
+
+	for n, err := range v {
+		if n > 0 {
+			sb.WriteByte('\n')
+		}
+
+		sb.WriteString(err.Error())
+	}
+
+	return sb.String()
+}
+
+// Unwrap returns the list of errors.
+func (v VerifyErrors) Unwrap() []error {
+	errs := make([]error, len(v))
+
+	for n, err := range v {
+		errs[n] = err
+	}
+
+	return errs
+}
+
+var (
+	// ErrUnsortedNames is reported by Verify when the child names of a
+	// Node are not in strictly ascending order.
+	ErrUnsortedNames = errors.New("child names not sorted")
+
+	// ErrOverlappingNodes is reported by Verify when a Node overlaps
+	// another Node.
+	ErrOverlappingNodes = errors.New("overlapping nodes")
+)
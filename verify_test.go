@@ -0,0 +1,154 @@
+package tree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	tree := genLargeTree(3)
+
+	for n, opts := range [...]Options{
+		{},
+		{Checksums: true},
+		{Hash: sha256.New},
+		{Dedup: true},
+		{Compression: CodecFlate},
+		{Checksums: true, Hash: sha256.New, Dedup: true, Compression: CodecZlib},
+	} {
+		var buf bytes.Buffer
+
+		if err := SerialiseWithOptions(&buf, &tree, opts); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if err := Verify(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		}
+	}
+
+	if err := Verify(bytes.NewReader(nil), 0); err != nil {
+		t.Errorf("empty tree: unexpected error: %s", err)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	for n, test := range [...]struct {
+		Input  []byte
+		Errors VerifyErrors
+	}{
+		{ // 1
+			Input:  []byte{0x05, 0x21},
+			Errors: VerifyErrors{{Offset: 1, Err: ErrInvalidNode}},
+		},
+		{ // 2
+			Input:  []byte{0x05, 0x00, 0x02, 0x81},
+			Errors: VerifyErrors{{Offset: 0, Err: UnknownExtensionError(5)}},
+		},
+		{ // 3
+			Input:  []byte{'B', 'A', 0x00, 0x00, 0x08, 0x08, 0x02, 0x41},
+			Errors: VerifyErrors{{Offset: 1, Err: ErrUnsortedNames}},
+		},
+		{ // 4
+			Input:  []byte{'A', 'A', 0x00, 0x00, 0x08, 0x08, 0x02, 0x41},
+			Errors: VerifyErrors{{Offset: 1, Err: ErrUnsortedNames}},
+		},
+		{ // 5
+			Input:  []byte{'A', 0x05, 0x08, 0x01, 0x41},
+			Errors: VerifyErrors{{Offset: 1, Err: ErrInvalidPointer}},
+		},
+		{ // 6
+			Input: []byte{'B', 'A', 0x00, 0x09, 0x08, 0x08, 0x02, 0x41},
+			Errors: VerifyErrors{
+				{Offset: 1, Err: ErrUnsortedNames},
+				{Offset: 3, Err: ErrInvalidPointer},
+			},
+		},
+		{ // 7
+			Input:  []byte{'a', 'b', 0x02, 0x21, 0x04, 0x21, 'X', 'Y', 0x04, 0x06, 0x08, 0x08, 0x02, 0x41},
+			Errors: VerifyErrors{{Offset: 0, Err: ErrOverlappingNodes}},
+		},
+		{ // 8
+			Input:  []byte{'A', 0x02, 0x08, 0x01, 0x41, 'B', 0x05, 0x08, 0x01, 0x41},
+			Errors: VerifyErrors{{Offset: 1, Err: ErrInvalidPointer}},
+		},
+	} {
+		err := Verify(bytes.NewReader(test.Input), int64(len(test.Input)))
+		if !reflect.DeepEqual(err, test.Errors) {
+			t.Errorf("test %d: expecting errors %v, got %v", n+1, test.Errors, err)
+		}
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	var buf bytes.Buffer
+
+	SerialiseWithOptions(&buf, testChild, Options{Checksums: true})
+
+	data := buf.Bytes()
+	data[bytes.Index(data, []byte("JKL"))] = 'j'
+
+	err := Verify(bytes.NewReader(data), int64(len(data)))
+
+	var errs VerifyErrors
+
+	if !errors.As(err, &errs) {
+		t.Fatalf("expecting VerifyErrors, got %v", err)
+	} else if len(errs) != 1 {
+		t.Fatalf("expecting 1 error, got %d", len(errs))
+	}
+
+	var ce ChecksumError
+
+	if !errors.As(errs[0], &ce) {
+		t.Errorf("expecting ChecksumError, got %v", errs[0])
+	}
+}
+
+func TestHostileInput(t *testing.T) {
+	for _, opts := range [...]Options{
+		{},
+		{HashIndexThreshold: 1, PrefixNames: 2, Compression: CodecFlate, Checksums: true},
+	} {
+		var buf bytes.Buffer
+
+		SerialiseWithOptions(&buf, testChild, opts)
+
+		for pos := range buf.Len() {
+			for _, mask := range [...]byte{0x01, 0x80, 0xff} {
+				data := bytes.Clone(buf.Bytes())
+				data[pos] ^= mask
+
+				Verify(bytes.NewReader(data), int64(len(data)))
+				walkAll(OpenAt(bytes.NewReader(data), int64(len(data))))
+
+				if m, err := OpenMem(data); err == nil {
+					walkAll(m)
+				}
+			}
+		}
+	}
+}
+
+func walkAll(node Node) {
+	node.WriteTo(io.Discard)
+
+	for name, child := range node.Children() {
+		if _, ok := child.(ChildrenError); ok {
+			return
+		}
+
+		switch n := node.(type) {
+		case *Tree:
+			n.Child(name)
+		case *MemTree:
+			n.Child(name)
+		}
+
+		walkAll(child)
+	}
+}
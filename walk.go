@@ -53,6 +53,32 @@ func walk(n Node, fn WalkFunc, path []string) error {
 	return nil
 }
 
+// SkipShared wraps a WalkFunc so that it is only called for the first
+// occurrence of any Node that is shared between multiple parents, such as in a
+// tree serialised with the Dedup option.
+//
+// Subsequent occurrences of a shared Node, and all of its children, will be
+// skipped.
+//
+// Only Tree and MemTree Nodes from a single tree can be detected as shared.
+func SkipShared(fn WalkFunc) WalkFunc {
+	seen := make(map[int64]struct{})
+
+	return func(path []string, n Node) error {
+		if p, ok := n.(pointerNode); ok {
+			if ptr := p.pointer(); ptr != 0 {
+				if _, ok := seen[ptr]; ok {
+					return SkipNode
+				}
+
+				seen[ptr] = struct{}{}
+			}
+		}
+
+		return fn(path, n)
+	}
+}
+
 // Flatten iterates through the tree returning each path and node in lexical
 // order.
 func Flatten(n Node) iter.Seq2[[]string, Node] {
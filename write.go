@@ -2,6 +2,10 @@
 package tree // import "vimagination.zapto.org/tree"
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"hash/crc32"
 	"io"
 	"iter"
 	"slices"
@@ -48,9 +52,10 @@ func (o OffsetWriter) Seek(_ int64, _ int) (int64, error) {
 //	Names     []string (stored in lexical order)
 //	Pointers  []int64  (pointer to the end (&Size + 1) of each child node record, stored as variable-length integers; length of pointer stored in NameSizes)
 //	NameSizes []uint64 (lengths of each name and pointer, stored as variable-length integers; bottom three bits are the length of the pointer - 1, remaining bits are name length)
-//	Data      []byte
-//	Sizes     []uint64 (size of NamesSizes and Data sections, stored as variable-length integers; zeros are omitted)
-//	Size      uint8  (lower 5 bits: size of the Sizes field, bit 6: size Data > 0, bit 7: size NameSizes > 0)
+//	Data       []byte
+//	Extensions []byte   (optional records, each a uint8 type, a variable-length integer length, and the record bytes)
+//	Sizes      []uint64 (size of NamesSizes, Data, and Extensions sections, stored as variable-length integers; zeros are omitted)
+//	Size       uint8    (lower 5 bits: size of the Sizes field, bit 6: size Data > 0, bit 7: size NameSizes > 0, bit 8: size Extensions > 0)
 //
 // NB: All slices are stored without separators.
 //
@@ -60,25 +65,146 @@ func (o OffsetWriter) Seek(_ int64, _ int) (int64, error) {
 // The OffsetWriter type can be used to wrap an io.Writer to provide a custom
 // offset, or to have Serialise ignore the underlying Writers position.
 func Serialise(w io.Writer, root Node) error {
-	sw := byteio.StickyLittleEndianWriter{Writer: w}
+	return SerialiseWithOptions(w, root, Options{})
+}
+
+// Options contains the optional format extensions that can be enabled when
+// serialising a tree.
+//
+// Trees serialised with any of these options enabled can be read by Tree and
+// MemTree as normal. Nodes using Compression or PrefixNames are written in an
+// extended form that readers predating these options will refuse to read;
+// nodes using only the other options can still be opened by such readers,
+// but their Sizes section will be misread.
+type Options struct {
+	// Metadata, when set, stores the Metadata provided by each Node (see
+	// the Metadata type) alongside it.
+	Metadata bool
+
+	// Checksums stores a CRC32C checksum of the contents of each Node, which
+	// will be verified by Tree and MemTree when the Node is read.
+	//
+	// The checksum covers every byte of the Node except the checksum record
+	// itself. Altering the type of that record, or removing the Extensions
+	// section and its size, leaves a Node that is read without verification.
+	Checksums bool
+
+	// Hash, when set, is used to compute the Merkle hash of each Node (see
+	// the Hash function), which is then stored with the Node and can be
+	// retrieved with the Hash method of Tree and MemTree.
+	Hash func() hash.Hash
+
+	// Dedup, when set, will cause any Node that is identical to an already
+	// written Node to not be written, instead pointing to the existing Node.
+	//
+	// Each Node, including its data, will be buffered in memory before being
+	// written.
+	Dedup bool
+
+	// Compression, when non-zero, is the ID of the registered Codec that
+	// will be used to compress the data of each Node.
+	//
+	// The data of each Node will be buffered in memory, and will only be
+	// stored compressed when that is smaller than the uncompressed data.
+	// As with PrefixNames, Nodes with compressed data are written with
+	// extended Size Flags.
+	Compression uint8
+
+	// HashIndexThreshold, when greater than zero, causes a hash table of
+	// the child names to be stored with each Node that has at least this
+	// many children, allowing Tree and MemTree to find a child without
+	// searching through the names, and allowing Tree to do so without
+	// reading the sizes of all of the children.
+	HashIndexThreshold int
+
+	// PrefixNames, when greater than zero, stores the names of the
+	// children of each Node with any prefix shared with the previous name
+	// removed, storing every PrefixNames-th name in full.
+	//
+	// Names will only be stored this way for Nodes where it reduces the
+	// size of the Node. Such Nodes are written with extended Size Flags,
+	// which zero the size bits and move the size of the Sizes section to a
+	// preceding byte, so that readers which predate this option fail to
+	// read them instead of misreading the names.
+	PrefixNames int
+}
+
+// SerialiseWithOptions writes a tree structure to the given writer, as with
+// Serialise, using the format extensions enabled in the given Options.
+func SerialiseWithOptions(w io.Writer, root Node, opts Options) error {
+	_, err := serialise(w, root, opts)
+
+	return err
+}
+
+type writer struct {
+	byteio.StickyLittleEndianWriter
+	Options
+	out      io.Writer
+	checksum hash.Hash32
+	written  map[[sha256.Size]byte]int64
+	codec    Codec
+	hashID   []byte
+}
+
+func newWriter(w io.Writer, opts Options) (*writer, error) {
+	sw := &writer{Options: opts, out: w}
 
 	if s, ok := w.(io.Seeker); ok {
 		pos, err := s.Seek(0, io.SeekCurrent)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		sw.Count = pos
 	}
 
-	writeNode(&sw, root)
+	if opts.Checksums {
+		sw.checksum = crc32.New(castagnoli)
+		w = io.MultiWriter(w, sw.checksum)
+	}
+
+	if opts.Hash != nil {
+		sw.hashID = hashID(opts.Hash)
+	}
+
+	if opts.Dedup {
+		sw.written = make(map[[sha256.Size]byte]int64)
+	}
+
+	if opts.Compression != 0 {
+		codec, err := getCodec(opts.Compression)
+		if err != nil {
+			return nil, err
+		}
+
+		sw.codec = codec
+	}
+
+	sw.Writer = w
+
+	return sw, nil
+}
+
+func serialise(w io.Writer, root Node, opts Options) (int64, error) {
+	sw, err := newWriter(w, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	ptr, _ := writeNode(sw, root)
+
+	if sw.Err != nil {
+		return 0, sw.Err
+	}
 
-	return sw.Err
+	return ptr, nil
 }
 
 type child struct {
 	name string
 	pos  int64
+	hash []byte
 }
 
 type children []child
@@ -95,44 +221,216 @@ func (d DuplicateChildError) Error() string {
 	return "duplicate child name: " + strings.Join(d, "/")
 }
 
-func writeNode(w *byteio.StickyLittleEndianWriter, node Node) {
-	start, sizeChildren := getAndWriteChildren(w, node)
+func writeNode(w *writer, node Node) (int64, []byte) {
+	c := getAndWriteChildren(w, node)
 
 	if w.Err != nil {
-		return
+		return 0, nil
 	}
 
-	startData := w.Count
+	var meta *Metadata
 
-	if _, err := node.WriteTo(w); err != nil {
-		w.Err = err
+	if w.Metadata {
+		var err error
+
+		if meta, err = nodeMetadata(node); err != nil {
+			w.Err = err
 
-		return
+			return 0, nil
+		}
 	}
 
-	if start != w.Count {
-		startSizes := w.Count
-		dataSize := startSizes - startData
+	return writeRecord(w, c, node, meta)
+}
 
-		var toWrite uint8
+func writeRecord(w *writer, c children, data io.WriterTo, meta *Metadata) (int64, []byte) {
+	start := w.Count
 
-		if sizeChildren > 0 {
-			w.WriteUintX(uint64(sizeChildren))
+	if w.checksum != nil {
+		w.checksum.Reset()
+	}
+
+	var (
+		buf    bytes.Buffer
+		stream = w.Writer
+	)
 
-			toWrite |= 0x40
+	if w.written != nil {
+		w.Writer = &buf
+
+		if w.checksum != nil {
+			w.Writer = io.MultiWriter(&buf, w.checksum)
 		}
+	}
+
+	var (
+		sizeChildren, restart, layout = writeChildren(w, c)
+		startData                     = w.Count
+		dataHash                      hash.Hash
+		sum                           []byte
+	)
+
+	if w.Hash != nil {
+		dataHash = w.Hash()
+	}
+
+	rawSize := w.writeData(data, dataHash)
+	if w.Err != nil {
+		return 0, nil
+	}
+
+	if dataHash != nil {
+		sum = merkleHash(w.Hash(), dataHash.Sum(nil), c)
+	}
+
+	if start != w.Count || meta != nil || sum != nil {
+		startExtensions := w.Count
+		dataSize := startExtensions - startData
+
+		w.writeExtensions(c, layout, restart, sum, rawSize, meta)
+
+		extensionsSize := w.Count - startExtensions
+
+		if w.checksum != nil {
+			extensionsSize += checksumRecordSize
+		}
+
+		sizes := sizesTrailer(sizeChildren, dataSize, extensionsSize, rawSize >= 0 || restart > 0)
+
+		if w.checksum != nil {
+			w.writeChecksum(sizes)
+		}
+
+		w.Write(sizes)
+	}
+
+	if w.written != nil {
+		w.Writer = stream
+
+		return w.dedup(start, buf.Bytes()), sum
+	} else if start == w.Count {
+		return 0, sum
+	}
+
+	return w.Count, sum
+}
+
+// sizesTrailer returns the Sizes section for a Node with the given section
+// sizes, followed by the Sizes Length byte, when the Node is in the extended
+// form, and the Size Flags.
+func sizesTrailer(children, data, extensions int64, extended bool) []byte {
+	var (
+		buf   bytes.Buffer
+		bw    = byteio.StickyLittleEndianWriter{Writer: &buf}
+		flags uint8
+	)
 
-		if dataSize > 0 {
-			w.WriteUintX(uint64(dataSize))
+	if children > 0 {
+		bw.WriteUintX(uint64(children))
 
-			toWrite |= 0x20
+		flags |= 0x40
+	}
+
+	if data > 0 {
+		bw.WriteUintX(uint64(data))
+
+		flags |= 0x20
+	}
+
+	if extensions > 0 {
+		bw.WriteUintX(uint64(extensions))
+
+		flags |= 0x80
+	}
+
+	sizesLen := uint8(buf.Len())
+
+	if extended {
+		buf.WriteByte(sizesLen)
+
+		sizesLen = 0
+	}
+
+	buf.WriteByte(flags | sizesLen)
+
+	return buf.Bytes()
+}
+
+func (w *writer) writeData(data io.WriterTo, dataHash hash.Hash) int64 {
+	var (
+		dw  io.Writer = w
+		raw bytes.Buffer
+	)
+
+	if w.codec != nil {
+		dw = &raw
+	}
+
+	if dataHash != nil {
+		dw = io.MultiWriter(dw, dataHash)
+	}
+
+	if _, err := data.WriteTo(dw); err != nil {
+		w.Err = err
+
+		return -1
+	}
+
+	if w.codec == nil || raw.Len() == 0 {
+		return -1
+	}
+
+	var compressed bytes.Buffer
+
+	cw, err := w.codec.NewWriter(&compressed)
+	if err == nil {
+		if _, err = cw.Write(raw.Bytes()); err == nil {
+			err = cw.Close()
 		}
+	}
+
+	if err != nil {
+		w.Err = err
+
+		return -1
+	}
+
+	if compressed.Len() >= raw.Len() {
+		w.Write(raw.Bytes())
 
-		w.WriteUint8(toWrite | uint8(w.Count-startSizes))
+		return -1
 	}
+
+	w.Write(compressed.Bytes())
+
+	return int64(raw.Len())
+}
+
+func (w *writer) dedup(start int64, data []byte) int64 {
+	if w.Err != nil || len(data) == 0 {
+		return 0
+	}
+
+	key := sha256.Sum256(data)
+
+	if ptr, ok := w.written[key]; ok {
+		w.Count = start
+
+		return ptr
+	}
+
+	if _, err := w.out.Write(data); err != nil {
+		w.Err = err
+
+		return 0
+	}
+
+	w.written[key] = w.Count
+
+	return w.Count
 }
 
-func getAndWriteChildren(w *byteio.StickyLittleEndianWriter, node Node) (int64, int64) {
+func getAndWriteChildren(w *writer, node Node) children {
 	var c children
 
 	for name, childNode := range node.Children() {
@@ -144,65 +442,88 @@ func getAndWriteChildren(w *byteio.StickyLittleEndianWriter, node Node) (int64,
 		if found {
 			w.Err = DuplicateChildError{name}
 
-			return 0, 0
+			return nil
 		}
 
-		start := w.Count
+		if r, ok := childNode.(reused); ok {
+			cn.pos = r.ptr
 
-		writeNode(w, childNode)
-
-		if w.Err != nil {
-			if dce, ok := w.Err.(DuplicateChildError); ok {
-				w.Err = slices.Insert(dce, 0, name)
+			if w.Hash != nil {
+				if cn.hash, w.Err = hashNode(r.Node, w.Hash, w.hashID); w.Err != nil {
+					return nil
+				}
 			}
+		} else {
+			cn.pos, cn.hash = writeNode(w, childNode)
 
-			return 0, 0
-		}
+			if w.Err != nil {
+				if dce, ok := w.Err.(DuplicateChildError); ok {
+					w.Err = slices.Insert(dce, 0, name)
+				}
 
-		cn.pos = w.Count
-		if start == cn.pos {
-			cn.pos = 0
+				return nil
+			}
 		}
 
 		c = slices.Insert(c, childPos, cn)
 	}
 
-	start := w.Count
-
-	return start, writeChildren(w, c)
+	return c
 }
 
-func writeChildren(w *byteio.StickyLittleEndianWriter, c children) int64 {
+// writeChildren writes the Names, Pointers, and NameSizes sections for the
+// given children, returning the size of the NameSizes section, the restart
+// interval of front-coded names, and the positions of the names and pointers.
+func writeChildren(w *writer, c children) (int64, int, []childNameSizes) {
 	if len(c) == 0 {
-		return 0
+		return 0, 0, nil
 	}
 
 	sort.Slice(c, c.Less)
 
-	for _, child := range c {
-		w.WriteString(child.name)
+	names := make([]string, len(c))
+
+	var size, restart int
+
+	for n, child := range c {
+		names[n] = child.name
+		size += len(child.name)
+	}
+
+	if w.PrefixNames > 0 {
+		if entries, prefixSize := prefixEncode(c, w.PrefixNames); prefixSize+prefixRecordSize(w.PrefixNames) < size {
+			names = entries
+			restart = w.PrefixNames
+		}
 	}
 
-	ptrSizes := make([]uint8, len(c))
+	layout := make([]childNameSizes, len(c))
+
+	for n, name := range names {
+		layout[n].nameStart = w.Count
+		layout[n].nameLength = int64(len(name))
+
+		w.WriteString(name)
+	}
 
 	for n, child := range c {
-		start := w.Count
+		layout[n].ptrStart = w.Count
 
 		writePointer(w, uint64(child.pos))
 
-		ptrSizes[n] = uint8(w.Count - start - 1)
+		layout[n].ptrLength = uint8(w.Count - layout[n].ptrStart)
 	}
 
 	sizeStart := w.Count
 
-	for n, child := range c {
-		w.WriteUintX(uint64(len(child.name))<<3 | uint64(ptrSizes[n]))
+	for _, child := range layout {
+		w.WriteUintX(uint64(child.nameLength)<<3 | uint64(child.ptrLength-1))
 	}
 
-	return w.Count - sizeStart
+	return w.Count - sizeStart, restart, layout
 }
 
-func writePointer(w *byteio.StickyLittleEndianWriter, ptr uint64) {
+func writePointer(w *writer, ptr uint64) {
 	if ptr < 0x100 {
 		w.WriteUint8(uint8(ptr))
 	} else if ptr < 0x10000 {
@@ -145,3 +145,61 @@ func (errorWriter) Children() iter.Seq2[string, Node] {
 func (errorWriter) WriteTo(_ io.Writer) (int64, error) {
 	return 0, io.ErrShortWrite
 }
+
+func TestSerialiseDedup(t *testing.T) {
+	shared := Branch{
+		{"config.json", Leaf("{}")},
+		{"data", Leaf("0123456789")},
+	}
+	tree := Branch{
+		{"A", shared},
+		{"B", shared},
+		{"C", Branch{
+			{"D", shared},
+			{"E", Leaf("{}")},
+		}},
+	}
+
+	var buf, dedup bytes.Buffer
+
+	Serialise(&buf, tree)
+
+	if err := SerialiseWithOptions(&dedup, tree, Options{Dedup: true, Checksums: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if dedup.Len() >= buf.Len() {
+		t.Errorf("expecting deduplicated tree to be smaller than %d bytes, got %d", buf.Len(), dedup.Len())
+	}
+
+	expected := readTree(tree)
+
+	if read := readTree(OpenAt(bytes.NewReader(dedup.Bytes()), int64(dedup.Len()))); !reflect.DeepEqual(read, expected) {
+		t.Errorf("Tree: did not read what we wrote")
+	}
+
+	m, err := OpenMem(dedup.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if read := readTree(m); !reflect.DeepEqual(read, expected) {
+		t.Errorf("MemTree: did not read what we wrote")
+	}
+
+	var all, unique int
+
+	Walk(m, func(_ []string, _ Node) error {
+		all++
+
+		return nil
+	})
+
+	Walk(m, SkipShared(func(_ []string, _ Node) error {
+		unique++
+
+		return nil
+	}))
+
+	if all != 11 {
+		t.Errorf("expecting to walk 11 nodes, walked %d", all)
+	} else if unique != 4 {
+		t.Errorf("expecting to walk 4 unique nodes, walked %d", unique)
+	}
+}
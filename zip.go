@@ -0,0 +1,218 @@
+package tree
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"iter"
+	"path"
+	"slices"
+	"strings"
+)
+
+type zipDir struct {
+	names    []string
+	children map[string]Node
+	meta     *Metadata
+}
+
+type zipFile struct {
+	*zip.File
+}
+
+// FromZip returns a Node that presents the contents of the given zip archive
+// as a tree.
+//
+// Each file in the archive becomes a childless Node containing the contents of
+// the file, and each directory becomes a Node containing its entries, with any
+// directories missing from the archive being created. When an archive contains
+// more than one entry for the same path, the last is used.
+//
+// The mode and modification time of each entry are available as the Metadata
+// of its Node, and so will be stored when serialising with the Metadata
+// option; directories missing from the archive have no Metadata.
+//
+// The directory structure is built from the central directory of the archive,
+// but the contents of each file are not read until the Node is written, and so
+// the returned Node can be passed to Serialise without decompressing the
+// entire archive into memory.
+func FromZip(r *zip.Reader) Node {
+	root := newZipDir()
+
+	for _, f := range r.File {
+		name := path.Clean("/" + f.Name)[1:]
+		if name == "" {
+			continue
+		}
+
+		dir := root
+		parts := strings.Split(name, "/")
+
+		for _, part := range parts[:len(parts)-1] {
+			dir = dir.dir(part)
+		}
+
+		if name = parts[len(parts)-1]; f.FileInfo().IsDir() {
+			dir.dir(name).meta = zipMetadata(f)
+		} else {
+			dir.set(name, zipFile{f})
+		}
+	}
+
+	return root
+}
+
+func zipMetadata(f *zip.File) *Metadata {
+	return &Metadata{Mode: f.Mode(), ModTime: f.Modified}
+}
+
+func newZipDir() *zipDir {
+	return &zipDir{children: make(map[string]Node)}
+}
+
+func (z *zipDir) dir(name string) *zipDir {
+	if d, ok := z.children[name].(*zipDir); ok {
+		return d
+	}
+
+	d := newZipDir()
+
+	z.set(name, d)
+
+	return d
+}
+
+func (z *zipDir) set(name string, node Node) {
+	if pos, found := slices.BinarySearch(z.names, name); !found {
+		z.names = slices.Insert(z.names, pos, name)
+	}
+
+	z.children[name] = node
+}
+
+// Children returns an iterator that loops through the entries of the
+// directory, in lexical order.
+func (z *zipDir) Children() iter.Seq2[string, Node] {
+	return func(yield func(string, Node) bool) {
+		for _, name := range z.names {
+			if !yield(name, z.children[name]) {
+				return
+			}
+		}
+	}
+}
+
+// WriteTo always returns 0, nil for a directory.
+func (*zipDir) WriteTo(_ io.Writer) (int64, error) {
+	return 0, nil
+}
+
+// NumChildren returns the number of entries in the directory.
+func (z *zipDir) NumChildren() int {
+	return len(z.names)
+}
+
+// Metadata returns the mode and modification time of the directory entry, or
+// nil if the directory was not in the archive.
+func (z *zipDir) Metadata() *Metadata {
+	return z.meta
+}
+
+// Children always returns an empty iterator for a file.
+func (zipFile) Children() iter.Seq2[string, Node] {
+	return noChildren
+}
+
+// WriteTo decompresses the contents of the file to the given writer.
+func (z zipFile) WriteTo(w io.Writer) (int64, error) {
+	r, err := z.Open()
+	if err != nil {
+		return 0, err
+	}
+
+	defer r.Close()
+
+	return io.Copy(w, r)
+}
+
+// DataLen returns the uncompressed size of the file, as recorded in the
+// archive.
+//
+// The recorded size is not checked until the file is read, at which point
+// WriteTo will return an error if the contents do not match it.
+func (z zipFile) DataLen() int64 {
+	return int64(z.UncompressedSize64)
+}
+
+// Metadata returns the mode and modification time of the file.
+func (z zipFile) Metadata() *Metadata {
+	return zipMetadata(z.File)
+}
+
+// ToZip writes the given tree to w as a zip archive, with the entries in the
+// order given by Flatten.
+//
+// Each Node with children is written as a directory, and each Node without
+// children is written as a deflated file containing the data of the Node. The
+// mode and modification time of each entry are taken from any stored Metadata.
+//
+// As with ToTar, any Node, other than the root, with both data and children
+// will cause ErrMixedNode to be returned, any name that is not a valid path
+// element will cause an InvalidNameError to be returned, and data stored on
+// the root Node will cause ErrRootData to be returned.
+//
+// The zip archive is closed, but w is not.
+func ToZip(w io.Writer, node Node) error {
+	if err := checkRootData(node); err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+
+	for p, n := range Flatten(node) {
+		if ce, ok := n.(ChildrenError); ok {
+			return ce.error
+		}
+
+		entry, err := newArchiveEntry(p, n)
+		if err != nil {
+			return err
+		}
+
+		hdr := &zip.FileHeader{
+			Name:   entry.name,
+			Method: zip.Deflate,
+		}
+
+		if entry.dir {
+			hdr.Method = zip.Store
+
+			hdr.SetMode(fs.ModeDir | 0o755)
+		}
+
+		if entry.meta != nil {
+			mode := entry.meta.Mode.Perm()
+
+			if entry.dir {
+				mode |= fs.ModeDir
+			}
+
+			hdr.SetMode(mode)
+
+			hdr.Modified = entry.meta.ModTime
+		}
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+
+		if !entry.dir {
+			if _, err := n.WriteTo(fw); err != nil {
+				return err
+			}
+		}
+	}
+
+	return zw.Close()
+}
@@ -0,0 +1,229 @@
+package tree
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFromZip(t *testing.T) {
+	var archive bytes.Buffer
+
+	zw := zip.NewWriter(&archive)
+
+	for _, entry := range [...]struct {
+		name, data string
+	}{
+		{name: "z.txt", data: "last"},
+		{name: "dir/"},
+		{name: "dir/sub/b.txt", data: "123"},
+		{name: "dir/a.txt", data: "old"},
+		{name: "dir/a.txt", data: "new"},
+		{name: "empty/"},
+	} {
+		w, _ := zw.Create(entry.name)
+
+		io.WriteString(w, entry.data)
+	}
+
+	zw.Close()
+
+	zr, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := node{
+		children: []node{
+			{
+				name: "dir",
+				children: []node{
+					{
+						name: "a.txt",
+						data: []byte("new"),
+					},
+					{
+						name: "sub",
+						children: []node{
+							{
+								name: "b.txt",
+								data: []byte("123"),
+							},
+						},
+					},
+				},
+			},
+			{
+				name: "empty",
+			},
+			{
+				name: "z.txt",
+				data: []byte("last"),
+			},
+		},
+	}
+
+	root := FromZip(zr)
+
+	if read := readTree(root); !reflect.DeepEqual(read, expected) {
+		t.Errorf("Node: expecting %v, got %v", expected, read)
+	}
+
+	if dir, err := Child(root, "dir"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if meta, _ := nodeMetadata(dir); meta == nil || !meta.Mode.IsDir() {
+		t.Errorf("expecting directory metadata, got %v", meta)
+	} else if sub, err := Child(dir, "sub"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if meta, _ := nodeMetadata(sub); meta != nil {
+		t.Errorf("expecting no metadata on created directory, got %v", meta)
+	}
+
+	var buf bytes.Buffer
+
+	if err := Serialise(&buf, root); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if read := readTree(OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))); !reflect.DeepEqual(read, expected) {
+		t.Errorf("Tree: expecting %v, got %v", expected, read)
+	}
+}
+
+func TestToZip(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+	tree := Branch{
+		{Name: "a", Node: Branch{{Name: "b", Node: Leaf("123")}}},
+		{Name: "c", Node: metaNode{Leaf("456"), &Metadata{Mode: 0o600, ModTime: modTime}}},
+	}
+
+	var buf bytes.Buffer
+
+	if err := ToZip(&buf, tree); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var names []string
+
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+
+		if f.Name == "c" {
+			if f.Mode() != 0o600 {
+				t.Errorf("expecting mode %s, got %s", fs.FileMode(0o600), f.Mode())
+			}
+
+			if !f.Modified.Equal(modTime) {
+				t.Errorf("expecting modification time %s, got %s", modTime, f.Modified)
+			}
+		}
+	}
+
+	if expected := []string{"a/", "a/b", "c"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expecting names %v, got %v", expected, names)
+	}
+
+	if read, expected := readTree(FromZip(zr)), readTree(tree); !reflect.DeepEqual(read, expected) {
+		t.Errorf("expecting %v, got %v", expected, read)
+	}
+
+	for n, test := range [...]struct {
+		Input Node
+		Error error
+	}{
+		{ // 1
+			Input: Branch{{Name: "a", Node: &node{data: []byte("1"), children: []node{{name: "b"}}}}},
+			Error: ErrMixedNode,
+		},
+		{ // 2
+			Input: &node{data: []byte("1"), children: []node{{name: "b"}}},
+			Error: ErrRootData,
+		},
+		{ // 3
+			Input: Leaf("1"),
+			Error: ErrRootData,
+		},
+	} {
+		var buf bytes.Buffer
+
+		if err := ToZip(&buf, test.Input); !errors.Is(err, test.Error) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Error, err)
+		} else if errors.Is(err, ErrRootData) && buf.Len() != 0 {
+			t.Errorf("test %d: expecting nothing to be written, got %d bytes", n+1, buf.Len())
+		}
+	}
+}
+
+func TestFromZipMetadata(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+
+	var archive bytes.Buffer
+
+	if err := ToZip(&archive, Branch{
+		{Name: "a", Node: metaNode{Leaf(""), &Metadata{Mode: fs.ModeDir | 0o700, ModTime: modTime}}},
+		{Name: "b", Node: Branch{{Name: "c", Node: metaNode{Leaf("123"), &Metadata{Mode: 0o600, ModTime: modTime}}}}},
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := SerialiseWithOptions(&buf, FromZip(zr), Options{Metadata: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tree := OpenAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+
+	for n, test := range [...]struct {
+		Path []string
+		Mode fs.FileMode
+		Time time.Time
+	}{
+		{ // 1
+			Path: []string{"a"},
+			Mode: fs.ModeDir | 0o700,
+			Time: modTime,
+		},
+		{ // 2
+			Path: []string{"b", "c"},
+			Mode: 0o600,
+			Time: modTime,
+		},
+	} {
+		if child, err := tree.Navigate(slices.Values(test.Path)); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if meta, err := child.Metadata(); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if meta == nil {
+			t.Errorf("test %d: expecting metadata", n+1)
+		} else if meta.Mode != test.Mode {
+			t.Errorf("test %d: expecting mode %s, got %s", n+1, test.Mode, meta.Mode)
+		} else if !meta.ModTime.Equal(test.Time) {
+			t.Errorf("test %d: expecting modification time %s, got %s", n+1, test.Time, meta.ModTime)
+		}
+	}
+
+	for _, f := range zr.File {
+		if f.Name == "b/c" {
+			f.UncompressedSize64 = 10
+		}
+	}
+
+	if err := Serialise(io.Discard, FromZip(zr)); err == nil {
+		t.Errorf("expecting error for incorrect uncompressed size")
+	}
+}